@@ -1,38 +1,95 @@
-/*	Reads data from BenchmarkData.dat (four rows per language, first is name, second is compile command or "-" if interpreted, third is run command, fourth is source file name).
+/*	Reads the languages from the JSON manifest BenchmarkData.json (or the file given by -manifest): for each, its name, build command (empty if interpreted),
+	run command, source files, the artifact the build produces, the directory to work in, extra environment variables, a run timeout and tags.
+	Manifests ending in .dat are read in the legacy format of five lines per language; "go run Benchmarker.go convert old.dat new.json" converts one.
+	Checks the manifest before anything is compiled, reporting each problem with its file and line and skipping the languages that have them;
+	"go run Benchmarker.go validate" just does the check.
+	The -only, -skip and -tags flags pick which languages to benchmark, by name, glob or tag, without editing the manifest.
+	Builds and runs each language in its own directory under -scratch, holding copies of its sources and links to the support files it names,
+	so artifacts never collide.
 	If flag -c=true is set, compiles the languages read from that file and records their compile time, as well as measuring the size of their output file.
-	Runs them, recording their resident memory usage.
-	Waits WaitTime seconds between each run.
-	Outputs their framerate data to FrameFile, runs Frames2PPM.go and saves the output to LangName.ppm
+	Compiles one language at a time, or up to -compilejobs at once, each still timed on its own but slowed by the contention.
+	Compiles and runs that take longer than -compiletimeout or -runtimeout (or the language's own timeout) are killed, along with everything they started,
+	and recorded as timing out.
+	Runs them -reps times each, recording their cpu time, context switches and page faults from the rusage wait4 returns, in the order -schedule gives: all of one language's runs before the next (sequential),
+	a run of each language in turn (roundrobin), or a shuffle of every run seeded with -seed (shuffle), to spread thermal drift and background load evenly.
+	Before each run, waits until the CPU temperature (from the thermal zones in sysfs) and load average fall below -maxtemp and -maxload, for up to -maxwait;
+	sleeps WaitTime seconds instead if -cooldown=fixed or there are no thermal zones to read.
+	Keeps every run's metrics and summarises them as the mean, median, standard deviation, range and 95% confidence interval of the mean.
+	If -telemetry is set, shows live progress from the per-frame telemetry each language streams to a Unix socket, if it supports that, and reports stalls;
+	it's off by default, since streaming adds work to the measured frames that languages without telemetry don't do.
+	Reads each run's results from the JSON result document if the implementation printed one, otherwise scrapes the legacy text.
+	Pins each run to the CPUs and nice value given with -cpus and -nice, or by the language's manifest entry, and records them with the run.
+	Samples the resident memory and threads of each run's whole process tree from procfs every -meminterval, along with each process's cpu time and peak memory,
+	so the work of launchers like lein and mono can be credited to the processes they start; reports which process did the most.
+	Its peak resident memory is the largest VmHWM of any process in the tree but the launching shell; rusage's can't be used,
+	as the shell inherits Benchmarker's own peak when it's started.
+	Outputs their framerate data to FrameFile, runs Frames2PPM.go and saves the output to LangName.ppm, and likewise graphs their per-frame render times to LangName.gpu.ppm
+	and their memory timelines to LangName.mem.ppm
 	Outputs their framerate, memory usage and compile time to stdout.
 	Compresses their source files and records their size.
-	Outputs all the above data to an HTML table in ResultsTable.html
+	Appends every language's results, with all its runs, frame series and environment, the session's start time and the git revision of the sources,
+	to the JSON Lines store -store (ResultsHistory.jsonl), which "go run Benchmarker.go query" searches.
+	"go run Benchmarker.go compare baseline.jsonl [current.jsonl]" compares the last session in a store with the last in a baseline store,
+	printing the change in each language's metrics and exiting with status 1 if any got worse by more than its threshold.
+	"go run Benchmarker.go trend" graphs each language's framerate, cpu time, memory and compile time over the sessions in the store to LangName.trend.*.ppm,
+	and writes a table of the changes between consecutive sessions to TrendReport.html.
+	Records the machine each language ran on (CPU, cores, kernel, memory, frequency governor) and any environment the implementation reports about itself.
+	Outputs all the above data to an HTML table in ResultsTable.html, headed by a description of the machine
 */
 
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
+	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
 	"time"
 	"unicode"
+	"unsafe"
 )
 
 const (
-	langFile  = "BenchmarkData.dat"
-	FrameFile = "Frames.dat"
-	WaitTime  = 120
+	langFile     = "BenchmarkData.dat" // The legacy manifest converted by default
+	manifestFile = "BenchmarkData.json"
+	FrameFile    = "Frames.dat"
+	WaitTime     = 120
+
+	ResultSchema  = "particlebench.result"    // Identifies the JSON result document
+	ResultVersion = 1                         // The newest result document version understood
+	TelemetryEnv  = "PARTICLEBENCH_TELEMETRY" // Tells implementations where to stream per-frame telemetry
 )
 
 var (
-	langs     []Lang
-	dataLines []string
+	langs    []Lang
+	runOrder []string // Name and repetition of each run, in the order they ran
+	// When this session started, identifying its records in the results store
+	sessionStart time.Time
+	// How many compiles ran at once, or zero if nothing was compiled
+	compileConcurrency int
+	host               HostInfo // The machine this session runs on, for the report header
+
+	procRoot = flag.String("procroot", "/proc", "Where procfs is mounted; point it at a fake tree for testing")
+	sysRoot  = flag.String("sysroot", "/sys", "Where sysfs is mounted; point it at a fake tree for testing")
 )
 
 type Lang struct {
@@ -41,80 +98,1364 @@ type Lang struct {
 	Run         string
 	SourceName  string
 	ExeName     string
+	Sources     []string      // All the source files; SourceName is the first
+	Dir         string        // Where to build and run, relative to the working directory
+	SrcDir      string        // Where the sources and support files are, if Dir is a scratch directory
+	Support     []string      // Globs of other files and directories the build or run needs, relative to SrcDir
+	Env         []string      // KEY=value pairs added to the environment of the build and run commands
+	Timeout     time.Duration // How long a run may take, or zero for the default
+	CPUs        string        // CPU list to pin runs to, or "" for -cpus
+	Nice        *int          // Nice value to run with, or nil for -nice
+	Tags        []string
 	CmplTime    float64
-	Results     string
+	CmplOutcome string            // "ok", "failed" or "timeout", or "" if it wasn't compiled
+	Runs        []LangRun         // Every repetition, in the order they ran
+	Format      string            // How the representative run's results were read: "json" or "text"
+	Frames      []float64         // Framerate of each measured frame of the representative run
+	GpuTimes    []float64         // Seconds each measured frame of the representative run spent rendering and swapping buffers
+	Memory      []MemSample       // The representative run's memory timeline
+	Tree        TreeUsage         // How the representative run's work was split over its processes
+	Stalls      int               // Times the telemetry stream stopped for longer than -stall, over all runs
+	Host        HostInfo          // The machine as it was when the representative run started
+	Environment map[string]string // What the implementation reported about its runtime and build, if anything
 	Loaded      bool
 	Interpreted bool
-	FPS         float64
+	FPS         float64 // Mean over the runs that reported it, as are CpuTime, GpuTime and MemUse
+	FPSStats    Stats
 	PcntMaxFps  float64
 	CpuTime     float64
+	CpuStats    Stats
 	PcntMinCpu  float64
+	GpuTime     float64
 	Compiler    string
 	MemUse      int64
+	MemStats    Stats
+	Usage       Usage // Mean over the runs
 	CompSize    int64
 	LOC         int
 	NumChars    int
 	ExeSize     int
 }
 
+// LangRun is one repetition of a language, as run and then parsed.
+type LangRun struct {
+	Repetition  int // Counting from 1
+	Order       int // Position in the session's run schedule, counting from 1
+	Placement   Placement
+	Cooldown    time.Duration
+	Temperature float64 // Degrees Celsius of the hottest thermal zone when the run started, or zero if unknown
+	Started     time.Time
+	Failed      bool   // The run command exited with an error, so none of the metrics below were read
+	Outcome     string // "ok", "failed" or "timeout"
+	Results     string
+	Format      string
+	FPS         float64
+	CpuTime     float64
+	GpuTime     float64
+	MemUse      int64 // Peak resident KiB of the whole tree, from Tree
+	Usage       Usage
+	Frames      []float64
+	GpuTimes    []float64
+	Memory      []MemSample
+	Tree        TreeUsage
+	Stalls      int
+	Host        HostInfo
+	Environment map[string]string
+}
+
+// Usage is what the kernel accounted to a run's shell and every descendant it waited for. It leaves out ru_maxrss,
+// since Go starts the shell sharing Benchmarker's memory, and the kernel carries that memory's peak over when the shell execs.
+type Usage struct {
+	UserTime   float64 `json:"user_time"` // Seconds
+	SysTime    float64 `json:"sys_time"`
+	VolCtxSw   float64 `json:"voluntary_ctx_switches"`   // Voluntary context switches, from blocking
+	InvolCtxSw float64 `json:"involuntary_ctx_switches"` // Involuntary context switches, from preemption
+	MinFlt     float64 `json:"minor_faults"`             // Page faults served without I/O
+	MajFlt     float64 `json:"major_faults"`             // Page faults that needed I/O
+}
+
+func usageFrom(ru *syscall.Rusage) Usage {
+	seconds := func(tv syscall.Timeval) float64 { return float64(tv.Sec) + float64(tv.Usec)/1e6 }
+	return Usage{UserTime: seconds(ru.Utime), SysTime: seconds(ru.Stime),
+		VolCtxSw: float64(ru.Nvcsw), InvolCtxSw: float64(ru.Nivcsw), MinFlt: float64(ru.Minflt), MajFlt: float64(ru.Majflt)}
+}
+
+// Stats summarises one metric over a language's runs; it's all zero if no run reported the metric.
+type Stats struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	StdDev float64 `json:"stddev"` // Sample standard deviation, zero for a single run
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	CILow  float64 `json:"ci_low"` // The 95% confidence interval for the mean, from Student's t distribution
+	CIHigh float64 `json:"ci_high"`
+}
+
+func summarise(samples []float64) Stats {
+	if len(samples) == 0 {
+		return Stats{}
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	st := Stats{N: len(sorted), Mean: mean(sorted), Min: sorted[0], Max: sorted[len(sorted)-1]}
+	if st.N%2 == 1 {
+		st.Median = sorted[st.N/2]
+	} else {
+		st.Median = (sorted[st.N/2-1] + sorted[st.N/2]) / 2
+	}
+	if st.N > 1 {
+		sumSq := 0.0
+		for _, v := range sorted {
+			sumSq += (v - st.Mean) * (v - st.Mean)
+		}
+		st.StdDev = math.Sqrt(sumSq / float64(st.N-1))
+	}
+	halfWidth := tCritical95(st.N-1) * st.StdDev / math.Sqrt(float64(st.N))
+	st.CILow, st.CIHigh = st.Mean-halfWidth, st.Mean+halfWidth
+	return st
+}
+
+func tCritical95(df int) float64 { // Two-sided 95% critical value of Student's t distribution with df degrees of freedom
+	table := []float64{0, 12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228, 2.201, 2.179, 2.160, 2.145, 2.131,
+		2.120, 2.110, 2.101, 2.093, 2.086, 2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042}
+	switch { // Between tabulated values, use the next lower df's, whose larger value keeps the interval from being too narrow
+	case df < len(table):
+		return table[df]
+	case df < 40:
+		return 2.042 // df = 30
+	case df < 60:
+		return 2.021 // df = 40
+	case df < 120:
+		return 2.000 // df = 60
+	}
+	return 1.980 // df = 120
+}
+
+func (st Stats) String() string {
+	return fmt.Sprintf("mean %.4g, median %.4g, standard deviation %.3g, min %.4g, max %.4g, 95%% CI [%.4g, %.4g]", st.Mean, st.Median, st.StdDev, st.Min, st.Max, st.CILow, st.CIHigh)
+}
+
+type Result struct { // The JSON result document; see GoResult.go for the authoritative definition
+	Schema     string        `json:"schema"`
+	Version    int           `json:"version"`
+	Metrics    ResultMetrics `json:"metrics"`
+	FrameTimes []float64     `json:"frame_times"`
+	GpuTimes   []float64     `json:"gpu_times"`
+	Run        ResultRun     `json:"run"`
+
+	Environment map[string]string `json:"environment"`
+}
+
+type ResultMetrics struct {
+	FPS       float64 `json:"fps"`
+	FPSStdDev float64 `json:"fps_stddev"`
+	CpuTime   float64 `json:"cpu_time"`
+	GpuTime   float64 `json:"gpu_time"`
+}
+
+type ResultRun struct {
+	Implementation string    `json:"implementation"`
+	Renderer       string    `json:"renderer"`
+	MeasuredFrames int       `json:"measured_frames"`
+	Finished       time.Time `json:"finished"`
+}
+
+type HostInfo struct {
+	Hostname string `json:"hostname"`
+	CPUModel string `json:"cpu_model"`
+	Cores    int    `json:"cores"` // Logical CPUs
+	Kernel   string `json:"kernel"`
+	MemTotal int64  `json:"mem_total"` // KiB
+	Governor string `json:"governor"`  // CPU frequency scaling governor of cpu0
+}
+
+func readHostInfo() HostInfo {
+	var h HostInfo
+	h.Hostname, _ = os.Hostname()
+	if cpuinfo, err := ioutil.ReadFile(filepath.Join(*procRoot, "cpuinfo")); err == nil {
+		for _, line := range strings.Split(string(cpuinfo), "\n") {
+			key, val := splitField(line)
+			switch key {
+			case "processor":
+				h.Cores++
+			case "model name":
+				if h.CPUModel == "" {
+					h.CPUModel = val
+				}
+			}
+		}
+	}
+	if h.Cores == 0 {
+		h.Cores = runtime.NumCPU()
+	}
+	h.Kernel = readLine(filepath.Join(*procRoot, "sys/kernel/osrelease"))
+	if meminfo, err := ioutil.ReadFile(filepath.Join(*procRoot, "meminfo")); err == nil {
+		for _, line := range strings.Split(string(meminfo), "\n") {
+			if key, val := splitField(line); key == "MemTotal" {
+				h.MemTotal, _ = strconv.ParseInt(strings.TrimSuffix(val, " kB"), 10, 64)
+			}
+		}
+	}
+	h.Governor = readLine(filepath.Join(*sysRoot, "devices/system/cpu/cpu0/cpufreq/scaling_governor"))
+	return h
+}
+
+func (h HostInfo) String() string {
+	unknown := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return s
+	}
+	return fmt.Sprintf("%v: %v CPU with %v cores, kernel %v, %v KiB of memory, %v frequency governor",
+		unknown(h.Hostname), unknown(h.CPUModel), h.Cores, unknown(h.Kernel), h.MemTotal, unknown(h.Governor))
+}
+
+func splitField(line string) (string, string) { // Splits a "key: value" line from procfs
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", ""
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+}
+
+func readLine(path string) string { // The trimmed contents of a one-line file, or "" if it can't be read
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(contents))
+}
+
+func formatEnvironment(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + env[k]
+	}
+	return strings.Join(keys, ", ")
+}
+
+type FrameRecord struct { // One frame of telemetry; see GoTelemetry.go for the authoritative definition
+	Frame     uint64  `json:"frame"`
+	Time      float64 `json:"time"`
+	FrameTime float64 `json:"frame_time"`
+	Live      int     `json:"live"`
+}
+
+const ManifestVersion = 1
+
+type Manifest struct {
+	Version   int             `json:"version"`
+	Languages []ManifestEntry `json:"languages"`
+}
+
+type ManifestEntry struct {
+	Name     string            `json:"name"`
+	Build    string            `json:"build,omitempty"` // Empty for interpreted languages
+	Run      string            `json:"run"`
+	Sources  []string          `json:"sources"`            // The first is measured for compressed size and lines of code
+	Artifact string            `json:"artifact,omitempty"` // The executable the build produces, measured for size
+	Dir      string            `json:"dir,omitempty"`      // Where the sources are, relative to the manifest
+	Support  []string          `json:"support,omitempty"`  // Globs of other files and directories needed to build and run, relative to dir
+	Env      map[string]string `json:"env,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"` // How long a run may take, as a Go duration such as "5m"
+	CPUs     string            `json:"cpus,omitempty"`    // CPUs to run on, as a list such as "0-3,6", instead of -cpus
+	Nice     *int              `json:"nice,omitempty"`    // Scheduling priority to run with, instead of -nice
+	Tags     []string          `json:"tags,omitempty"`    // For selecting languages, such as compiled, interpreted or jvm
+	line     int               // Where the entry starts in the manifest, for reporting problems
+}
+
+var (
+	manifestFlag = flag.String("manifest", manifestFile, "The manifest of languages to benchmark; files ending in .dat are read in the legacy five-line format")
+	onlyFlag     = flag.String("only", "", "Comma-separated names or globs of the languages to benchmark, such as C,Cpp,Nimrod*; default all")
+	skipFlag     = flag.String("skip", "", "Comma-separated names or globs of languages not to benchmark")
+	tagsFlag     = flag.String("tags", "", "Comma-separated tags, such as compiled,jvm; only languages with at least one of them are benchmarked")
+)
+
 func loadLangs() {
-	contents, err := ioutil.ReadFile(langFile)
+	entries, err := readManifest(*manifestFlag)
 	if err != nil {
-		panic(err)
+		fmt.Println("Failed to read the manifest:", err)
+		os.Exit(1)
 	}
-	dataLines = strings.Split(string(contents), "\n")
-	for i, _ := range dataLines {
-		dataLines[i] = strings.Trim(dataLines[i], "\n\r")
+	entries, err = selectEntries(entries, splitList(*onlyFlag), splitList(*skipFlag), splitList(*tagsFlag))
+	if err != nil {
+		fmt.Println("Failed to select languages:", err)
+		os.Exit(1)
+	}
+	problems, bad := validateManifest(*manifestFlag, entries)
+	for _, problem := range problems {
+		fmt.Println(problem)
 	}
-	for i := 0; i < len(dataLines)-1; i += 5 {
-		thisLang := Lang{Name: dataLines[i], Commands: dataLines[i+1], Run: dataLines[i+2], SourceName: dataLines[i+3], ExeName: dataLines[i+4], Loaded: true, Interpreted: dataLines[i+1] == "-"}
+	for i, entry := range entries {
+		if bad[i] {
+			fmt.Printf("Skipping language %v because of the problems above.\n", entry.Name)
+			continue
+		}
+		thisLang, err := langFromEntry(entry, filepath.Dir(*manifestFlag))
+		if err != nil {
+			panic(err)
+		}
 		langs = append(langs, thisLang)
 	}
 }
 
-func compileLangs() {
-	for i, lang := range langs {
-		if lang.Interpreted == true {
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// selectEntries keeps the entries whose names match one of only (or all, if only is empty) and none of skip, and that have one of tags.
+// Names and patterns are compared case-insensitively, with patterns in filepath.Match syntax.
+func selectEntries(entries []ManifestEntry, only, skip, tags []string) ([]ManifestEntry, error) {
+	matches := func(patterns []string, used map[string]bool, name string) (bool, error) {
+		for _, pattern := range patterns {
+			ok, err := filepath.Match(strings.ToLower(pattern), strings.ToLower(name))
+			if err != nil {
+				return false, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+			if ok {
+				used[pattern] = true
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	usedOnly, usedSkip, usedTags := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	var selected []ManifestEntry
+	for _, entry := range entries {
+		if len(only) > 0 {
+			ok, err := matches(only, usedOnly, entry.Name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		ok, err := matches(skip, usedSkip, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
 			continue
 		}
-		fmt.Printf("Now compiling language %v.\n", lang.Name)
-		initT := time.Now()
-		_, err := runCommand(lang.Commands)
+		tagged := len(tags) == 0
+		for _, tag := range entry.Tags {
+			ok, err := matches(tags, usedTags, tag)
+			if err != nil {
+				return nil, err
+			}
+			tagged = tagged || ok
+		}
+		if !tagged {
+			continue
+		}
+		selected = append(selected, entry)
+	}
+	for _, list := range []struct {
+		flag     string
+		patterns []string
+		used     map[string]bool
+	}{{"only", only, usedOnly}, {"skip", skip, usedSkip}, {"tags", tags, usedTags}} {
+		for _, pattern := range list.patterns {
+			if !list.used[pattern] {
+				fmt.Printf("Nothing in the manifest matches -%v %v.\n", list.flag, pattern)
+			}
+		}
+	}
+	return selected, nil
+}
+
+func readManifest(path string) ([]ManifestEntry, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".dat") {
+		return parseLegacyManifest(path, contents)
+	}
+	return parseManifest(path, contents)
+}
+
+// parseManifest decodes a JSON manifest a token at a time, so that each entry's line is known and errors can say where they are.
+func parseManifest(path string, contents []byte) ([]ManifestEntry, error) {
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	var valueStart int64 // Where the value being decoded starts
+	nextValue := func() int64 {
+		valueStart = dec.InputOffset()
+		for valueStart < int64(len(contents)) && strings.IndexByte(" \t\r\n,:", contents[valueStart]) >= 0 {
+			valueStart++
+		}
+		return valueStart
+	}
+	fail := func(err error) ([]ManifestEntry, error) {
+		offset := dec.InputOffset()
+		switch err := err.(type) {
+		case *json.SyntaxError:
+			offset = err.Offset
+		case *json.UnmarshalTypeError: // Its offset counts from the start of the value, not the file
+			offset = valueStart + err.Offset
+		case *unknownFieldError:
+			offset = valueStart + err.Offset
+		}
+		return nil, fmt.Errorf("%v:%v: %v", path, lineAt(contents, offset), err)
+	}
+	expect := func(want json.Delim) error {
+		tok, err := dec.Token()
+		if err == nil && tok != want {
+			err = fmt.Errorf("expected %v but found %v", want, tok)
+		}
+		return err
+	}
+	var manifest Manifest
+	if err := expect('{'); err != nil {
+		return fail(err)
+	}
+	for dec.More() {
+		key, err := dec.Token()
 		if err != nil {
-			fmt.Printf("Compilation of %v failed with error of %v\n", lang.Name, err)
+			return fail(err)
+		}
+		switch key {
+		case "version":
+			nextValue()
+			err = dec.Decode(&manifest.Version)
+		case "languages":
+			if err = expect('['); err != nil {
+				break
+			}
+			for err == nil && dec.More() {
+				entry := ManifestEntry{line: lineAt(contents, nextValue())}
+				var raw json.RawMessage
+				if err = dec.Decode(&raw); err == nil {
+					err = decodeEntry(raw, &entry)
+				}
+				if err == nil {
+					manifest.Languages = append(manifest.Languages, entry)
+				}
+			}
+			if err == nil {
+				err = expect(']')
+			}
+		default:
+			err = fmt.Errorf("unknown field %v", key)
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if manifest.Version > ManifestVersion {
+		return nil, fmt.Errorf("%v: manifest version %v is newer than the supported %v", path, manifest.Version, ManifestVersion)
+	}
+	return manifest.Languages, nil
+}
+
+type unknownFieldError struct {
+	Field  string
+	Offset int64 // From the start of the entry
+}
+
+func (e *unknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %q", e.Field)
+}
+
+// decodeEntry decodes one manifest entry, rejecting fields it doesn't know with an *unknownFieldError saying where the field is,
+// which encoding/json's own error doesn't.
+func decodeEntry(raw []byte, entry *ManifestEntry) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(entry)
+	if err == nil || !strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return err
+	}
+	field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+	return &unknownFieldError{Field: field, Offset: keyOffsets(raw)[field]}
+}
+
+func keyOffsets(raw []byte) map[string]int64 { // Where each key of the JSON object raw starts, not counting those of nested objects
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	offsets := map[string]int64{}
+	depth, expectKey := 0, false
+	for {
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return offsets
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			expectKey = depth == 1
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+			expectKey = depth == 1
+		default:
+			if key, ok := tok.(string); ok && depth == 1 && expectKey {
+				for before < int64(len(raw)) && strings.IndexByte(" \t\r\n,", raw[before]) >= 0 {
+					before++
+				}
+				offsets[key] = before
+			}
+			expectKey = depth == 1 && !expectKey
+		}
+	}
+}
+
+func lineAt(contents []byte, offset int64) int {
+	if offset > int64(len(contents)) {
+		offset = int64(len(contents))
+	}
+	return bytes.Count(contents[:offset], []byte("\n")) + 1
+}
+
+// validateManifest checks the entries for mistakes that would otherwise only show up as a confusing failure partway through a session,
+// returning the problems as "file:line: message" and the indices of the entries they were found in.
+func validateManifest(path string, entries []ManifestEntry) ([]string, map[int]bool) {
+	var problems []string
+	bad := map[int]bool{}
+	names := map[string]int{}     // Name to index of the first entry with it
+	artifacts := map[string]int{} // Artifact path to index of the first entry that builds it in place
+	for i, entry := range entries {
+		report := func(format string, args ...interface{}) {
+			problems = append(problems, fmt.Sprintf("%v:%v: %v", path, entry.line, fmt.Sprintf(format, args...)))
+			bad[i] = true
+		}
+		name := entry.Name
+		if name == "" {
+			name = fmt.Sprintf("language %v", i+1)
+			report("%v has no name", name)
+		} else if first, ok := names[name]; ok {
+			report("%v is listed twice; the first is on line %v", name, entries[first].line)
+		} else {
+			names[name] = i
+		}
+		if entry.Run == "" {
+			report("%v has no run command", name)
+		}
+		if len(entry.Sources) == 0 {
+			report("%v has no source files", name)
+		}
+		if entry.Timeout != "" {
+			if d, err := time.ParseDuration(entry.Timeout); err != nil || d <= 0 {
+				report("%v has an invalid timeout %q", name, entry.Timeout)
+			}
+		}
+		if entry.CPUs != "" {
+			if _, err := parseCPUList(entry.CPUs); err != nil {
+				report("%v has an invalid cpu list: %v", name, err)
+			}
+		}
+		if entry.Nice != nil && (*entry.Nice < -20 || *entry.Nice > 19) {
+			report("%v has nice %v, outside -20 to 19", name, *entry.Nice)
+		}
+		for k := range entry.Env {
+			if k == "" || strings.ContainsAny(k, "= ") {
+				report("%v has an invalid environment variable name %q", name, k)
+			}
+		}
+
+		dir := filepath.Join(filepath.Dir(path), entry.Dir)
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			report("%v's directory %v doesn't exist", name, dir)
+			continue // Everything else is relative to it
+		}
+		exists := func(file string) bool {
+			_, err := os.Stat(filepath.Join(dir, file))
+			return err == nil
+		}
+		for _, source := range entry.Sources {
+			if !exists(source) {
+				report("%v's source file %v doesn't exist", name, source)
+			}
+		}
+		if entry.Artifact != "" && *scratchRoot == "" { // Languages building in scratch directories can't collide
+			artifact := filepath.Join(dir, entry.Artifact)
+			if first, ok := artifacts[artifact]; ok {
+				report("%v builds %v, which %v on line %v also builds", name, entry.Artifact, entries[first].Name, entries[first].line)
+			} else {
+				artifacts[artifact] = i
+			}
+		}
+		for _, pattern := range entry.Support {
+			if matches, err := filepath.Glob(filepath.Join(dir, pattern)); err != nil {
+				report("%v has an invalid support pattern %q", name, pattern)
+			} else if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+				report("%v's support file %v doesn't exist", name, pattern)
+			}
+		}
+		missing := map[string]bool{}
+		for _, file := range referencedPaths(entry.Build + " " + entry.Run) {
+			if !exists(file) && !missing[file] && filepath.Clean(file) != filepath.Clean(entry.Artifact) {
+				report("%v refers to %v, which doesn't exist", name, file)
+				missing[file] = true
+			}
+		}
+	}
+	return problems, bad
+}
+
+// referencedPaths picks out the files a command needs to exist: the program, if it's given as a path, and classpath entries.
+func referencedPaths(command string) []string {
+	var paths []string
+	fields := strings.Fields(command)
+	for i, field := range fields {
+		if i == 0 && strings.Contains(field, "/") || i > 0 && fields[i-1] == "&&" && strings.Contains(field, "/") {
+			paths = append(paths, field)
+		}
+		if (field == "-classpath" || field == "-cp") && i+1 < len(fields) {
+			for _, entry := range strings.Split(strings.Trim(fields[i+1], `"'`), ":") {
+				if entry != "" && entry != "." {
+					paths = append(paths, entry)
+				}
+			}
+		}
+	}
+	return paths
+}
+
+// parseLegacyManifest reads the original format: five lines per language, giving its name, compile command (or "-" if it's interpreted),
+// run command, source file and executable file.
+func parseLegacyManifest(path string, contents []byte) ([]ManifestEntry, error) {
+	dataLines := strings.Split(string(contents), "\n")
+	for i := range dataLines {
+		dataLines[i] = strings.Trim(dataLines[i], "\n\r")
+	}
+	for len(dataLines) > 0 && dataLines[len(dataLines)-1] == "" {
+		dataLines = dataLines[:len(dataLines)-1]
+	}
+	misaligned := func(from int) bool { // Whether an entry from the one at from on is certainly out of place
+		for i := from; i < len(dataLines); i += 5 {
+			if _, certain := legacyEntryProblem(dataLines[i:]); certain {
+				return true
+			}
+		}
+		return false
+	}
+	var entries []ManifestEntry
+	for i := 0; i < len(dataLines); i += 5 {
+		problem, certain := legacyEntryProblem(dataLines[i:])
+		if problem != "" && !certain && !misaligned(i+5) { // Odd, but nothing after it says a line is missing or extra
+			problem = ""
+		}
+		if problem != "" && i >= 5 {
+			if shifted, _ := legacyEntryProblem(dataLines[i-1:]); shifted == "" { // The language before lost a line, and this one starts a line early
+				return nil, fmt.Errorf("%v:%v: language %q is missing one of its five lines, as the next language seems to start at line %v", path, i-4, dataLines[i-5], i)
+			}
+		}
+		if problem != "" {
+			return nil, fmt.Errorf("%v:%v: language %q %v", path, i+1, dataLines[i], problem)
+		}
+		entry := ManifestEntry{line: i + 1, Name: dataLines[i], Run: dataLines[i+2], Sources: []string{dataLines[i+3]}, Tags: []string{"compiled"}}
+		if dataLines[i+1] == "-" {
+			entry.Tags = []string{"interpreted"}
+		} else {
+			entry.Build = dataLines[i+1]
+		}
+		if dataLines[i+4] != "-" {
+			entry.Artifact = dataLines[i+4]
+		}
+		switch strings.Fields(entry.Run + " -")[0] { // Tag the languages sharing a runtime, so they can be picked out together
+		case "java", "lein":
+			entry.Tags = append(entry.Tags, "jvm")
+		case "mono":
+			entry.Tags = append(entry.Tags, "clr")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// legacyEntryProblem says what looks wrong with the legacy entry at the start of lines, or returns "" if its lines seem
+// to be where they should be, so a missing or extra line is caught at the first entry it pushes out of place. Only a
+// certain problem, such as a blank line or a name of "-", proves the lines are out of place; the rest (a compile command
+// without arguments, a run command that looks like a file) can be what the language really uses.
+func legacyEntryProblem(lines []string) (problem string, certain bool) {
+	if len(lines) < 5 {
+		return fmt.Sprintf("has only %v of its five lines", len(lines)), true
+	}
+	looksLikeSource := func(line string) bool { return !strings.ContainsAny(line, " \t/") && filepath.Ext(line) != "" }
+	name, build, run, source, artifact := lines[0], lines[1], lines[2], lines[3], lines[4]
+	for _, check := range []struct {
+		bad, certain bool
+		problem      string
+	}{
+		{name == "" || name == "-", true, "has no name, so a line is missing or extra before it"},
+		{build != "-" && !strings.ContainsAny(build, " \t"), build == "", fmt.Sprintf("has %q as its compile command, so a line is missing before it", build)},
+		{run == "" || run == "-" || looksLikeSource(run), run == "" || run == "-", fmt.Sprintf("has %q as its run command, so a line is missing before it", run)},
+		{source == "" || source == "-" || strings.ContainsAny(source, " \t"), source == "" || source == "-",
+			fmt.Sprintf("has %q as its source file, so a line is missing or extra before it", source)},
+		{artifact == "" || strings.ContainsAny(artifact, " \t"), artifact == "", fmt.Sprintf("has %q as its executable file, so a line is missing or extra before it", artifact)},
+	} {
+		if check.bad && problem == "" {
+			problem = check.problem
+		}
+		certain = certain || check.bad && check.certain
+	}
+	return problem, certain
+}
+
+func langFromEntry(entry ManifestEntry, manifestDir string) (Lang, error) {
+	thisLang := Lang{Name: entry.Name, Commands: entry.Build, Run: entry.Run, ExeName: entry.Artifact, Sources: entry.Sources,
+		Dir: filepath.Join(manifestDir, entry.Dir), Support: entry.Support, CPUs: entry.CPUs, Nice: entry.Nice, Tags: entry.Tags,
+		Loaded: true, Interpreted: entry.Build == ""}
+	if thisLang.Interpreted {
+		thisLang.Commands = "-"
+	}
+	if len(entry.Sources) > 0 {
+		thisLang.SourceName = entry.Sources[0]
+	}
+	keys := make([]string, 0, len(entry.Env))
+	for k := range entry.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		thisLang.Env = append(thisLang.Env, k+"="+entry.Env[k])
+	}
+	if entry.Timeout != "" {
+		var err error
+		if thisLang.Timeout, err = time.ParseDuration(entry.Timeout); err != nil {
+			return thisLang, fmt.Errorf("language %v has an invalid timeout: %v", entry.Name, err)
+		}
+	}
+	return thisLang, nil
+}
+
+// convertManifest writes the languages in a legacy .dat manifest to a JSON manifest.
+func convertManifest(from, to string) error {
+	contents, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	entries, err := parseLegacyManifest(from, contents)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(Manifest{Version: ManifestVersion, Languages: entries}, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(to, append(out, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Converted %v languages from %v to %v.\n", len(entries), from, to)
+	return nil
+}
+
+// prepareScratch gives each language a directory of its own under root to build and run in, with copies of its sources
+// (so they can be measured and compressed in place) and links to its support files. Leftovers from earlier sessions are
+// cleared when compiling, but kept otherwise, since they hold the executables.
+func prepareScratch(root string) {
+	used := map[string]bool{}
+	for i, lang := range langs {
+		name := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' {
+				return r
+			}
+			return '_'
+		}, lang.Name)
+		for base, n := name, 2; used[name]; n++ {
+			name = fmt.Sprintf("%v_%v", base, n)
+		}
+		used[name] = true
+		scratch, err := filepath.Abs(filepath.Join(root, name))
+		if err == nil && *cflag {
+			err = os.RemoveAll(scratch)
+		}
+		if err == nil {
+			err = os.MkdirAll(scratch, 0755)
+		}
+		for _, source := range lang.Sources {
+			if err == nil {
+				err = copyFile(filepath.Join(lang.Dir, source), filepath.Join(scratch, source))
+			}
+		}
+		for _, pattern := range lang.Support {
+			matches, _ := filepath.Glob(filepath.Join(lang.Dir, pattern))
+			for _, match := range matches {
+				if err != nil {
+					break
+				}
+				var target, rel string
+				if target, err = filepath.Abs(match); err == nil {
+					rel, err = filepath.Rel(lang.Dir, match)
+				}
+				if err == nil {
+					link := filepath.Join(scratch, rel)
+					os.Remove(link)
+					if err = os.MkdirAll(filepath.Dir(link), 0755); err == nil {
+						err = os.Symlink(target, link)
+					}
+				}
+			}
+		}
+		if err != nil {
+			fmt.Printf("Failed to prepare a scratch directory for language %v, failing with error %v\n", lang.Name, err)
 			langs[i].Loaded = false
+			continue
 		}
-		endT := time.Now()
-		langs[i].CmplTime = endT.Sub(initT).Seconds()
+		langs[i].SrcDir, langs[i].Dir = lang.Dir, scratch
+	}
+}
+
+func copyFile(from, to string) error {
+	contents, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
 	}
+	if err = os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to, contents, 0644)
+}
 
+func compileLangs() {
+	jobs := *compileJobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > 1 {
+		fmt.Printf("Compiling up to %v languages at once, so compile times include contention.\n", jobs)
+	}
+	var wg sync.WaitGroup
+	slots := make(chan bool, jobs)
+	for i, lang := range langs {
+		if lang.Interpreted == true || lang.Loaded == false { // Not loaded if its scratch directory couldn't be prepared, so Dir is still its sources
+			continue
+		}
+		wg.Add(1)
+		compileConcurrency = jobs
+		slots <- true
+		go func(lang *Lang) {
+			defer func() { <-slots; wg.Done() }()
+			compileLang(lang)
+		}(&langs[i])
+	}
+	wg.Wait()
+}
+
+func compileLang(lang *Lang) {
+	fmt.Printf("Now compiling language %v.\n", lang.Name)
+	initT := time.Now()
+	_, err := runCommandTimeout(*compileTimeout, lang.Dir, lang.Commands, lang.Env...)
+	lang.CmplOutcome = outcome(err)
+	if err == errTimeout {
+		fmt.Printf("Compilation of %v timed out after %v and was killed\n", lang.Name, *compileTimeout)
+		lang.Loaded = false
+	} else if err != nil {
+		fmt.Printf("Compilation of %v failed with error of %v\n", lang.Name, err)
+		lang.Loaded = false
+	}
+	endT := time.Now()
+	lang.CmplTime = endT.Sub(initT).Seconds()
 }
 
 func runLangs() {
+	var loaded []int
+	for i, lang := range langs {
+		if lang.Loaded == true {
+			loaded = append(loaded, i)
+		}
+	}
+	for order, i := range scheduleRuns(*scheduleFlag, loaded, *repetitions, *seed) {
+		run := runLang(langs[i], len(langs[i].Runs)+1)
+		run.Order = order + 1
+		langs[i].Runs = append(langs[i].Runs, run)
+		runOrder = append(runOrder, fmt.Sprintf("%v #%v", langs[i].Name, run.Repetition))
+	}
 	for i, lang := range langs {
 		if lang.Loaded == false {
 			continue
 		}
+		langs[i].Loaded = false
+		for _, run := range langs[i].Runs {
+			langs[i].Loaded = langs[i].Loaded || !run.Failed
+		}
+
+		if lang.Interpreted == true {
+			continue
+		}
+		if lang.ExeName == "" {
+			continue
+		}
+		resultingExecutable, err := ioutil.ReadFile(filepath.Join(lang.Dir, lang.ExeName))
+		if err != nil {
+			fmt.Printf("Error of: %v when opening executable file for language %v, unable to measure size.\n", err, lang.Name)
+			continue
+		}
+		langs[i].ExeSize = len(resultingExecutable) / 1000
+	}
+}
+
+var scheduleStrategies = []string{"sequential", "roundrobin", "shuffle"}
+
+// scheduleRuns returns the index of the language for each run, in the order the strategy runs them.
+func scheduleRuns(strategy string, loaded []int, reps int, seed int64) []int {
+	var order []int
+	switch strategy {
+	case "roundrobin":
+		for rep := 0; rep < reps; rep++ {
+			order = append(order, loaded...)
+		}
+	default: // sequential, and the starting point for shuffle
+		for _, i := range loaded {
+			for rep := 0; rep < reps; rep++ {
+				order = append(order, i)
+			}
+		}
+	}
+	if strategy == "shuffle" {
+		rand.New(rand.NewSource(seed)).Shuffle(len(order), func(a, b int) { order[a], order[b] = order[b], order[a] })
+	}
+	return order
+}
+
+const cooldownPoll = 2 * time.Second
+
+// coolDown waits before a run until the machine has settled, returning how long it waited.
+func coolDown() time.Duration {
+	start := time.Now()
+	temp, ok := cpuTemperature()
+	if *cooldown == "fixed" || !ok {
 		fmt.Println("Pausing to allow the system to cool down.")
 		time.Sleep(WaitTime * time.Second)
+		return time.Since(start)
+	}
+	for waiting := false; ; waiting = true {
+		load, _ := loadAverage() // Zero, and so no obstacle, if it can't be read
+		if temp < *maxTemp && load < *maxLoad {
+			if waiting {
+				fmt.Printf("Cooled down to %.1f°C with a load average of %.2f after %.0f seconds.\n", temp, load, time.Since(start).Seconds())
+			}
+			break
+		}
+		if !waiting {
+			fmt.Printf("Waiting for the system to cool down from %.1f°C with a load average of %.2f.\n", temp, load)
+		}
+		if time.Since(start) >= *maxWait {
+			fmt.Printf("Still at %.1f°C with a load average of %.2f after %.0f seconds; running anyway.\n", temp, load, time.Since(start).Seconds())
+			break
+		}
+		time.Sleep(cooldownPoll)
+		if temp, ok = cpuTemperature(); !ok {
+			break
+		}
+	}
+	return time.Since(start)
+}
+
+// cpuTemperature returns the hottest of the thermal zones in sysfs, in degrees Celsius.
+func cpuTemperature() (float64, bool) {
+	zones, _ := filepath.Glob(filepath.Join(*sysRoot, "class/thermal/thermal_zone*/temp"))
+	hottest, found := 0.0, false
+	for _, zone := range zones {
+		milli, err := strconv.ParseInt(readLine(zone), 10, 64)
+		if err != nil || milli <= 0 { // Unreadable, or a sensor that isn't wired up
+			continue
+		}
+		if temp := float64(milli) / 1000; !found || temp > hottest {
+			hottest, found = temp, true
+		}
+	}
+	return hottest, found
+}
+
+func loadAverage() (float64, bool) { // The one-minute load average from procfs
+	fields := strings.Fields(readLine(filepath.Join(*procRoot, "loadavg")))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
+
+func runLang(lang Lang, rep int) LangRun {
+	waited := coolDown()
+	if *repetitions > 1 {
+		fmt.Printf("Now running language %v, repetition %v of %v.\n", lang.Name, rep, *repetitions)
+	} else {
 		fmt.Printf("Now running language %v.\n", lang.Name)
-		out, err := runCommand(`command time -f 'max resident:\t%M KiB' ` + lang.Run)
-		if err != nil {
-			fmt.Printf("Running %v failed with error of %v", lang.Name, err)
-			langs[i].Loaded = false
+	}
+	run := LangRun{Repetition: rep, Host: readHostInfo(), Started: time.Now(), Cooldown: waited}
+	run.Temperature, _ = cpuTemperature()
+	env := lang.Env
+	var monitor *telemetryMonitor
+	if *telemetryFlag {
+		var err error
+		if monitor, err = startTelemetry(lang.Name); err != nil {
+			fmt.Printf("Failed to listen for telemetry from language %v, failing with error %v\n", lang.Name, err)
+		} else {
+			env = append(env[:len(env):len(env)], TelemetryEnv+"="+monitor.path)
+		}
+	}
+	timeout := *runTimeout
+	if lang.Timeout > 0 {
+		timeout = lang.Timeout
+	}
+	var sampler *treeSampler
+	startSampler := func(pid int) {
+		if *memInterval > 0 {
+			sampler = startTreeSampler(pid, *memInterval)
+		}
+	}
+	run.Placement = Placement{CPUs: *cpusFlag, Nice: *niceFlag}
+	if lang.CPUs != "" {
+		run.Placement.CPUs = lang.CPUs
+	}
+	if lang.Nice != nil {
+		run.Placement.Nice = *lang.Nice
+	}
+	out, usage, err := runCommandUsage(timeout, run.Placement, lang.Dir, lang.Run, startSampler, env...)
+	run.Usage = usage
+	run.Memory, run.Tree = sampler.stop()
+	run.MemUse = max(run.Tree.PeakRSS, run.Tree.LargestRSS) // A single process's VmHWM can exceed the sampled total, if its peak fell between samples
+	if monitor != nil {
+		run.Stalls = monitor.stop()
+	}
+	run.Outcome = outcome(err)
+	if err == errTimeout {
+		fmt.Printf("Running %v timed out after %v and was killed\n", lang.Name, timeout)
+		run.Failed = true
+	} else if err != nil {
+		fmt.Printf("Running %v failed with error of %v\n", lang.Name, err)
+		run.Failed = true
+	}
+	run.Results = string(out)
+	return run
+}
+
+func outcome(err error) string {
+	switch {
+	case err == errTimeout:
+		return "timeout"
+	case err != nil:
+		return "failed"
+	}
+	return "ok"
+}
+
+// MemSample is the memory of a run's process tree at one moment.
+type MemSample struct {
+	Time    float64 `json:"time"` // Seconds since the run started
+	RSS     int64   `json:"rss"`  // Resident KiB, summed over the tree
+	HWM     int64   `json:"hwm"`  // Peak resident KiB of the largest process so far
+	Threads int     `json:"threads"`
+	Procs   int     `json:"procs"`
+}
+
+// ProcUsage is what one process in a run's tree used, as of the last sample it was seen in.
+type ProcUsage struct {
+	Pid     int     `json:"pid"`
+	Comm    string  `json:"comm"`
+	CPUTime float64 `json:"cpu_time"` // User and system seconds
+	PeakRSS int64   `json:"peak_rss"` // KiB
+}
+
+// TreeUsage sums up a run's process tree. Processes that live for less than a sampling interval can be missed,
+// and the cpu time a process used after its last sample is, so CPUTime undercounts slightly; rusage has the exact totals.
+type TreeUsage struct {
+	Processes  int         `json:"processes"`   // How many different processes were seen
+	CPUTime    float64     `json:"cpu_time"`    // Seconds, summed over Procs
+	PeakRSS    int64       `json:"peak_rss"`    // The most resident KiB of the whole tree in any one sample
+	LargestRSS int64       `json:"largest_rss"` // The highest peak resident KiB of any one process but the launching shell, from VmHWM
+	Procs      []ProcUsage `json:"procs"`       // Most cpu time first
+}
+
+func (t TreeUsage) Dominant() ProcUsage { // The process that used the most cpu time, or the zero ProcUsage if none was seen
+	if len(t.Procs) == 0 {
+		return ProcUsage{}
+	}
+	return t.Procs[0]
+}
+
+const clockTicks = 100 // USER_HZ, the unit of cpu times in procfs, which Linux fixes at 100 for every architecture
+
+type treeSampler struct { // Samples the memory and cpu time of a process and its descendants until stopped
+	root     int
+	start    time.Time
+	samples  []MemSample
+	procs    map[int]*ProcUsage
+	quit     chan bool
+	finished chan bool
+}
+
+func startTreeSampler(root int, interval time.Duration) *treeSampler {
+	m := &treeSampler{root: root, start: time.Now(), procs: map[int]*ProcUsage{}, quit: make(chan bool), finished: make(chan bool)}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.sample()
+			select {
+			case <-ticker.C:
+			case <-m.quit:
+				m.finished <- true
+				return
+			}
 		}
-		langs[i].Results = string(out)
-		
-		if lang.Interpreted == true{
+	}()
+	return m
+}
+
+func (m *treeSampler) sample() {
+	s := MemSample{Time: time.Since(m.start).Seconds()}
+	known := make([]int, 0, len(m.procs))
+	for pid := range m.procs {
+		known = append(known, pid)
+	}
+	for pid, stat := range processTree(m.root, known) {
+		status, err := ioutil.ReadFile(filepath.Join(*procRoot, strconv.Itoa(pid), "status"))
+		if err != nil { // It's exited since we listed it
 			continue
 		}
-		resultingExecutable, err := ioutil.ReadFile(lang.ExeName)
+		proc := m.procs[pid]
+		if proc == nil {
+			proc = &ProcUsage{Pid: pid}
+			m.procs[pid] = proc
+		}
+		proc.Comm, proc.CPUTime = stat.Comm, float64(stat.UTime+stat.STime)/clockTicks // Comm changes when a launcher execs
+		s.Procs++
+		for _, line := range strings.Split(string(status), "\n") {
+			key, val := splitField(line)
+			n, _ := strconv.ParseInt(strings.TrimSuffix(val, " kB"), 10, 64)
+			switch key {
+			case "VmRSS":
+				s.RSS += n
+			case "VmHWM":
+				if n > s.HWM {
+					s.HWM = n
+				}
+				if n > proc.PeakRSS {
+					proc.PeakRSS = n
+				}
+			case "Threads":
+				s.Threads += int(n)
+			}
+		}
+	}
+	if len(m.samples) > 0 && m.samples[len(m.samples)-1].HWM > s.HWM { // Keep the peak of processes that have exited
+		s.HWM = m.samples[len(m.samples)-1].HWM
+	}
+	if s.Procs > 0 {
+		m.samples = append(m.samples, s)
+	}
+}
+
+// stop returns the memory timeline and the usage of each process; a nil *treeSampler has neither.
+func (m *treeSampler) stop() ([]MemSample, TreeUsage) {
+	if m == nil {
+		return nil, TreeUsage{}
+	}
+	close(m.quit)
+	<-m.finished
+	tree := TreeUsage{Processes: len(m.procs)}
+	for _, proc := range m.procs {
+		tree.CPUTime += proc.CPUTime
+		tree.Procs = append(tree.Procs, *proc)
+		if proc.PeakRSS > tree.LargestRSS && !(proc.Pid == m.root && proc.Comm == launcherShell) { // Unless the shell exec'd the language
+			tree.LargestRSS = proc.PeakRSS
+		}
+	}
+	sort.Slice(tree.Procs, func(i, j int) bool { return tree.Procs[i].CPUTime > tree.Procs[j].CPUTime })
+	for _, sample := range m.samples {
+		if sample.RSS > tree.PeakRSS {
+			tree.PeakRSS = sample.RSS
+		}
+	}
+	return m.samples, tree
+}
+
+// processTree reads the stat of root and all its descendants, found by following the children of each of their threads in procfs,
+// so only the tree is read rather than every process on the machine. A descendant orphaned by its parent exiting isn't anyone's child
+// any more, so the processes in known, those seen in earlier samples, are kept while they live and stay in root's process group,
+// which runCommand makes root lead; an orphan that was never sampled before its parent exited is missed.
+func processTree(root int, known []int) map[int]procStat {
+	tree := map[int]procStat{}
+	var walk func(pid int, stat procStat)
+	walk = func(pid int, stat procStat) {
+		tree[pid] = stat
+		for _, child := range childPids(pid) {
+			if _, seen := tree[child]; !seen {
+				if childStat, ok := readProcStat(child); ok {
+					walk(child, childStat)
+				}
+			}
+		}
+	}
+	if stat, ok := readProcStat(root); ok {
+		walk(root, stat)
+	}
+	for _, pid := range known {
+		if _, seen := tree[pid]; !seen {
+			if stat, ok := readProcStat(pid); ok && stat.PGrp == root { // Not a new process that reused the pid
+				walk(pid, stat)
+			}
+		}
+	}
+	return tree
+}
+
+func childPids(pid int) []int {
+	lists, _ := filepath.Glob(filepath.Join(*procRoot, strconv.Itoa(pid), "task", "*", "children"))
+	var children []int
+	for _, list := range lists {
+		contents, err := ioutil.ReadFile(list)
 		if err != nil {
-			fmt.Printf("Error of: %v when opening executable file for language %v, unable to measure size.\n", err, lang.Name)
 			continue
 		}
-		langs[i].ExeSize = len(resultingExecutable) / 1000
+		for _, field := range strings.Fields(string(contents)) {
+			if child, err := strconv.Atoi(field); err == nil {
+				children = append(children, child)
+			}
+		}
+	}
+	return children
+}
+
+type procStat struct { // The fields of /proc/<pid>/stat that we use
+	Comm  string
+	PPid  int
+	PGrp  int
+	UTime int64 // Clock ticks
+	STime int64
+}
+
+func readProcStat(pid int) (procStat, bool) {
+	contents, err := ioutil.ReadFile(filepath.Join(*procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, false
+	}
+	stat := string(contents)
+	open, end := strings.Index(stat, "("), strings.LastIndex(stat, ")") // The command name may itself contain spaces and brackets
+	if open < 0 || end < open {
+		return procStat{}, false
+	}
+	fields := strings.Fields(stat[end+1:]) // State, then parent pid, process group, ..., and the user and system times 11 and 12 along
+	if len(fields) < 13 {
+		return procStat{}, false
+	}
+	ps := procStat{Comm: stat[open+1 : end]}
+	var errs [4]error
+	ps.PPid, errs[0] = strconv.Atoi(fields[1])
+	ps.PGrp, errs[1] = strconv.Atoi(fields[2])
+	ps.UTime, errs[2] = strconv.ParseInt(fields[11], 10, 64)
+	ps.STime, errs[3] = strconv.ParseInt(fields[12], 10, 64)
+	for _, err := range errs {
+		if err != nil {
+			return procStat{}, false
+		}
+	}
+	return ps, true
+}
+
+type telemetryMonitor struct { // Listens for one language's telemetry, printing progress and noticing stalls
+	name     string
+	path     string
+	listener net.Listener
+	done     chan bool
+	mu       sync.Mutex // Guards the fields below
+	conns    []net.Conn
+	latest   FrameRecord
+	lastSeen time.Time
+	stalls   int
+}
+
+func startTelemetry(name string) (*telemetryMonitor, error) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("particlebench-%v.sock", os.Getpid()))
+	os.Remove(path) // Left behind if a previous run was killed
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	m := &telemetryMonitor{name: name, path: path, listener: listener, done: make(chan bool)}
+	go m.accept()
+	go m.watch()
+	return m, nil
+}
+
+func (m *telemetryMonitor) accept() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil { // The listener was closed by stop
+			return
+		}
+		m.mu.Lock()
+		m.conns = append(m.conns, conn)
+		m.mu.Unlock()
+		go m.read(conn)
+	}
+}
+
+func (m *telemetryMonitor) read(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var rec FrameRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			continue
+		}
+		m.mu.Lock()
+		m.latest = rec
+		m.lastSeen = time.Now()
+		m.mu.Unlock()
+	}
+}
+
+func (m *telemetryMonitor) watch() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	var shown uint64
+	stalled := false
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		rec, lastSeen := m.latest, m.lastSeen
+		m.mu.Unlock()
+		if lastSeen.IsZero() { // Not every implementation streams telemetry
+			continue
+		}
+		if since := time.Since(lastSeen); since > *stallTime {
+			if !stalled {
+				fmt.Printf("Language %v has sent no frames for %v and may be stuck.\n", m.name, since.Round(time.Second))
+				m.mu.Lock()
+				m.stalls++
+				m.mu.Unlock()
+				stalled = true
+			}
+			continue
+		}
+		stalled = false
+		if rec.Frame != shown {
+			fmt.Printf("%v: %.1f seconds in, frame %v at %.1f frames per second, %v live particles.\n", m.name, rec.Time, rec.Frame, 1/rec.FrameTime, rec.Live)
+			shown = rec.Frame
+		}
+	}
+}
+
+func (m *telemetryMonitor) stop() int { // Stops listening and returns how many stalls were seen
+	close(m.done)
+	m.listener.Close()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, conn := range m.conns {
+		conn.Close()
 	}
+	os.Remove(m.path)
+	return m.stalls
 }
 
 func graphLangs() {
@@ -123,68 +1464,289 @@ func graphLangs() {
 		if lang.Loaded == false {
 			continue
 		}
-		if strings.Index(lang.Results, "--:") < 0 || strings.Index(lang.Results, ".--") < 0 {
+		if len(lang.Frames) == 0 {
 			fmt.Printf("Could not read frame data for language %v.\n", lang.Name)
+		} else if err := graphSeries(lang.Name+".ppm", lang.Frames); err != nil {
+			fmt.Printf("Graphing framerates for language %v failed with error of %v\n", lang.Name, err)
+		}
+		if len(lang.GpuTimes) > 0 {
+			millis := make([]float64, len(lang.GpuTimes))
+			for i, t := range lang.GpuTimes {
+				millis[i] = t * 1000
+			}
+			if err := graphSeries(lang.Name+".gpu.ppm", millis, "-relative"); err != nil {
+				fmt.Printf("Graphing render times for language %v failed with error of %v\n", lang.Name, err)
+			}
+		}
+		if len(lang.Memory) > 0 {
+			mib := make([]float64, len(lang.Memory))
+			for i, sample := range lang.Memory {
+				mib[i] = float64(sample.RSS) / 1024
+			}
+			if err := graphSeries(lang.Name+".mem.ppm", mib, "-relative"); err != nil {
+				fmt.Printf("Graphing the memory timeline for language %v failed with error of %v\n", lang.Name, err)
+			}
+		}
+	}
+}
+
+// graphSeries writes series to FrameFile and saves the graph Frames2PPM.go draws of it, run with args, to graphFile.
+func graphSeries(graphFile string, series []float64, args ...string) error {
+	vals := make([]string, len(series))
+	for i, v := range series {
+		vals[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	err := ioutil.WriteFile(FrameFile, []byte(strings.Join(vals, ",")), 0644)
+	if err != nil {
+		return err
+	}
+	ppmDat, err := exec.Command("go", append([]string{"run", "Frames2PPM.go", "-in", FrameFile}, args...)...).Output()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(graphFile, ppmDat, 0644)
+}
+
+// parseLangs fills in each run's framerate, cpu time, frames and memory use from its output, then summarises the runs of each language.
+func parseLangs() {
+	for i, lang := range langs {
+		if lang.Loaded == false {
 			continue
 		}
-		frames := strings.TrimSpace(lang.Results[strings.Index(lang.Results, "--:")+3 : strings.Index(lang.Results, ".--")-1])
-		err := ioutil.WriteFile(FrameFile, []byte(frames), 0644)
-		if err != nil {
-			fmt.Printf("Failed to write frames to file for language %v, failing with error %v\n", lang.Name, err)
+		for j, run := range lang.Runs {
+			if !run.Failed {
+				parseRun(lang.Name, &langs[i].Runs[j])
+			}
+		}
+		summariseRuns(&langs[i])
+	}
+}
+
+func parseRun(name string, run *LangRun) {
+	if res, ok := findResult(name, run.Results); ok {
+		run.Format = "json"
+		run.FPS = res.Metrics.FPS
+		run.CpuTime = res.Metrics.CpuTime
+		run.Frames = make([]float64, 0, len(res.FrameTimes))
+		for _, t := range res.FrameTimes {
+			if t > 0 { // A zero would be an infinite framerate, which can't be averaged or stored
+				run.Frames = append(run.Frames, 1/t)
+			}
+		}
+		run.GpuTimes = res.GpuTimes
+		run.Environment = res.Environment
+	} else {
+		run.Format = "text"
+		parseLegacyResults(name, run)
+	}
+	if len(run.GpuTimes) > 0 {
+		run.GpuTime = mean(run.GpuTimes)
+	}
+}
+
+// summariseRuns computes the statistics of a language's runs, skipping metrics a run couldn't report,
+// and takes the frames and environment shown for it from the run whose framerate is closest to the median.
+func summariseRuns(lang *Lang) {
+	var fps, cpuTimes, gpuTimes, memUses []float64
+	var representative *LangRun
+	lang.Stalls, lang.Usage = 0, Usage{}
+	usageRuns := 0.0
+	for j := range lang.Runs {
+		run := &lang.Runs[j]
+		if run.Failed {
+			continue
+		}
+		if representative == nil {
+			representative = run
+		}
+		lang.Stalls += run.Stalls
+		if run.FPS > 0 {
+			fps = append(fps, run.FPS)
+		}
+		if run.CpuTime > 0 {
+			cpuTimes = append(cpuTimes, run.CpuTime)
+		}
+		if run.GpuTime > 0 {
+			gpuTimes = append(gpuTimes, run.GpuTime)
+		}
+		if run.MemUse > 0 {
+			memUses = append(memUses, float64(run.MemUse))
+		}
+		u := &lang.Usage
+		u.UserTime, u.SysTime = u.UserTime+run.Usage.UserTime, u.SysTime+run.Usage.SysTime
+		u.VolCtxSw, u.InvolCtxSw = u.VolCtxSw+run.Usage.VolCtxSw, u.InvolCtxSw+run.Usage.InvolCtxSw
+		u.MinFlt, u.MajFlt = u.MinFlt+run.Usage.MinFlt, u.MajFlt+run.Usage.MajFlt
+		usageRuns++
+	}
+	if u := &lang.Usage; usageRuns > 0 {
+		u.UserTime, u.SysTime = u.UserTime/usageRuns, u.SysTime/usageRuns
+		u.VolCtxSw, u.InvolCtxSw = u.VolCtxSw/usageRuns, u.InvolCtxSw/usageRuns
+		u.MinFlt, u.MajFlt = u.MinFlt/usageRuns, u.MajFlt/usageRuns
+	}
+	lang.FPSStats, lang.CpuStats, lang.MemStats = summarise(fps), summarise(cpuTimes), summarise(memUses)
+	lang.FPS, lang.CpuTime, lang.MemUse = lang.FPSStats.Mean, lang.CpuStats.Mean, int64(lang.MemStats.Mean)
+	lang.GpuTime = summarise(gpuTimes).Mean
+	for j := range lang.Runs {
+		run := &lang.Runs[j]
+		if !run.Failed && run.FPS > 0 && math.Abs(run.FPS-lang.FPSStats.Median) < math.Abs(representative.FPS-lang.FPSStats.Median) {
+			representative = run
+		}
+	}
+	if representative == nil {
+		return
+	}
+	lang.Format, lang.Frames, lang.GpuTimes = representative.Format, representative.Frames, representative.GpuTimes
+	lang.Memory, lang.Tree = representative.Memory, representative.Tree
+	lang.Host, lang.Environment = representative.Host, representative.Environment
+}
+
+// findResult returns the JSON result document printed by a language's run, if there is one it understands.
+func findResult(name, results string) (Result, bool) {
+	for _, line := range strings.Split(results, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") || strings.Index(line, ResultSchema) < 0 {
 			continue
 		}
-		graphFile := lang.Name + ".ppm"
-		ppmDat, err2 := exec.Command("go", "run", "Frames2PPM.go").Output()
-		if err2 != nil {
-			fmt.Printf("Graphing %v via Frames2PPM.go failed with error of %v\n", lang.Name, err)
+		var res Result
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			fmt.Printf("Failed to parse result document for language %v, failing with error %v\n", name, err)
+			continue
+		}
+		if res.Schema != ResultSchema {
+			continue
+		}
+		if res.Version > ResultVersion {
+			fmt.Printf("Result document for language %v has version %v, newer than the supported %v; falling back to the text output\n", name, res.Version, ResultVersion)
+			continue
+		}
+		return res, true
+	}
+	return Result{}, false
+}
+
+// parseLegacyResults scrapes the human-readable sentences and frame block that every implementation prints.
+func parseLegacyResults(name string, lang *LangRun) {
+	results := lang.Results
+	if strings.Index(results, "framerate was:") < 0 || strings.Index(results, " frames") < 0 {
+		fmt.Printf("Failed to read framerate results for language %v\n", name)
+	} else {
+		fps := strings.TrimSpace(results[strings.Index(results, "framerate was:")+14 : strings.Index(results, " frames")])
+		lang.FPS, _ = strconv.ParseFloat(fps, 32)
+	}
+	if strings.Index(results, "was-") < 0 || strings.Index(results, " seconds") < 0 {
+		fmt.Printf("Failed to read cpu time results for language %v\n", name)
+	} else {
+		cpuTime := strings.TrimSpace(results[strings.Index(results, "was-")+4 : strings.Index(results, " seconds")])
+		lang.CpuTime, _ = strconv.ParseFloat(cpuTime, 32)
+	}
+	lang.Frames = parseSeries(results, "--:", ".--")
+	lang.GpuTimes = parseSeries(results, "==:", ".==") // Only printed by some implementations
+}
+
+func parseSeries(results, start, end string) []float64 { // Reads the comma-separated numbers between start and end
+	if strings.Index(results, start) < 0 || strings.Index(results, end) < 0 {
+		return nil
+	}
+	var series []float64
+	for _, str := range strings.Split(results[strings.Index(results, start)+len(start):strings.Index(results, end)], ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil {
 			continue
 		}
-		err3 := ioutil.WriteFile(graphFile, []byte(ppmDat), 0644)
-		if err3 != nil {
-			fmt.Printf("Failed to write ppm graph to file for language %v, failing with error %v\n", lang.Name, err)
+		series = append(series, v)
+	}
+	return series
+}
+
+func mean(series []float64) float64 {
+	sum := 0.0
+	for _, v := range series {
+		sum += v
+	}
+	return sum / float64(len(series))
+}
+
+func printLangs() {
+	fmt.Println("Results from", host)
+	fmt.Printf("The runs were scheduled %v, in the order %v.\n", scheduleDescription(), strings.Join(runOrder, ", "))
+	if compileConcurrency > 1 {
+		fmt.Printf("Up to %v languages compiled at once, so compile times include contention.\n", compileConcurrency)
+	}
+	for _, lang := range langs {
+		if timeouts := describeTimeouts(lang); timeouts != "" {
+			fmt.Printf("Language %v %v.\n", lang.Name, timeouts)
+		}
+	}
+	for _, lang := range langs {
+		if lang.Loaded == false {
 			continue
 		}
+		fmt.Printf("The implementation in language %v compiled in %v seconds and ran with an average framerate of %v frames per second and an average cpu time of %v seconds per frame, using %v KiB of memory.\n", lang.Name, lang.CmplTime, orNA(lang.FPS), orNA(lang.CpuTime), orNA(float64(lang.MemUse)))
+		if len(lang.Environment) > 0 {
+			fmt.Printf("Language %v ran with %v.\n", lang.Name, formatEnvironment(lang.Environment))
+		}
+		if len(lang.Runs) > 0 && lang.Runs[0].Placement != (Placement{}) {
+			fmt.Printf("Language %v ran on %v.\n", lang.Name, lang.Runs[0].Placement)
+		}
+		if lang.GpuTime > 0 {
+			fmt.Printf("Language %v spent an average of %v seconds per frame rendering and swapping buffers.\n", lang.Name, lang.GpuTime)
+		}
+		u := lang.Usage
+		fmt.Printf("Language %v used %.2f seconds of user and %.2f of system cpu time, with %.0f voluntary and %.0f involuntary context switches and %.0f minor and %.0f major page faults.\n",
+			lang.Name, u.UserTime, u.SysTime, u.VolCtxSw, u.InvolCtxSw, u.MinFlt, u.MajFlt)
+		if len(lang.Memory) > 0 {
+			var peak MemSample
+			for _, sample := range lang.Memory {
+				if sample.RSS > peak.RSS {
+					peak = sample
+				}
+			}
+			fmt.Printf("Language %v's process tree peaked at %v KiB resident, %.1f seconds in, with %v processes and %v threads.\n",
+				lang.Name, peak.RSS, peak.Time, peak.Procs, peak.Threads)
+		}
+		if dom := lang.Tree.Dominant(); lang.Tree.Processes > 1 {
+			fmt.Printf("Language %v ran %v processes using %.2f seconds of cpu time between them; %v (pid %v) did the most, with %.2f seconds and a peak of %v KiB resident.\n",
+				lang.Name, lang.Tree.Processes, lang.Tree.CPUTime, dom.Comm, dom.Pid, dom.CPUTime, dom.PeakRSS)
+		}
+		if lang.Stalls > 0 {
+			fmt.Printf("Language %v stalled %v times while running.\n", lang.Name, lang.Stalls)
+		}
+		if len(lang.Runs) > 1 {
+			fmt.Printf("Over %v runs of language %v, the framerate had %v.\n", lang.FPSStats.N, lang.Name, lang.FPSStats)
+			fmt.Printf("Over %v runs of language %v, the cpu time had %v.\n", lang.CpuStats.N, lang.Name, lang.CpuStats)
+			fmt.Printf("Over %v runs of language %v, the memory use had %v.\n", lang.MemStats.N, lang.Name, lang.MemStats)
+		}
+	}
+}
+
+func describeTimeouts(lang Lang) string { // What timed out for the language, if anything
+	if lang.CmplOutcome == "timeout" {
+		return "timed out while compiling"
+	}
+	timeouts := 0
+	for _, run := range lang.Runs {
+		if run.Outcome == "timeout" {
+			timeouts++
+		}
+	}
+	if timeouts == 0 {
+		return ""
+	}
+	return fmt.Sprintf("timed out in %v of %v runs", timeouts, len(lang.Runs))
+}
+
+func scheduleDescription() string {
+	if *scheduleFlag == "shuffle" {
+		return fmt.Sprintf("shuffle with seed %v", *seed)
 	}
+	return *scheduleFlag
 }
 
-func printLangs() {
-	for i, lang := range langs {
-		if lang.Loaded == false {
-			continue
-		}
-		var fps string
-		var cpuTime string
-		var memUse string
-		//fmt.Println(lang.Results)
-		if strings.Index(lang.Results, "framerate was:") < 0 || strings.Index(lang.Results, " frames") < 0 {
-			fmt.Printf("Failed to read framerate results for language %v\n", lang.Name)
-			fps = "N/A"
-		} else {
-			fps = strings.TrimSpace(lang.Results[strings.Index(lang.Results, "framerate was:")+14 : strings.Index(lang.Results, " frames")])
-			langs[i].FPS, _ = strconv.ParseFloat(fps, 32)
-		}
-		if strings.Index(lang.Results, "was-") < 0 || strings.Index(lang.Results, " seconds") < 0 {
-			fmt.Printf("Failed to read cpu time results for language %v\n", lang.Name)
-			cpuTime = "N/A"
-		} else {
-			cpuTime = strings.TrimSpace(lang.Results[strings.Index(lang.Results, "was-")+4 : strings.Index(lang.Results, " seconds")])
-			langs[i].CpuTime, _ = strconv.ParseFloat(cpuTime, 32)
-		}
-		if strings.Index(lang.Results, "resident:") < 0 || strings.Index(lang.Results, "KiB") < 0 {
-			fmt.Printf("Failed to read memory usage results for language %v\n", lang.Name)
-			memUse = "N/A"
-		} else {
-			tmpStr := strings.TrimSpace(lang.Results[strings.Index(lang.Results, "resident:"):])
-			memUse = tmpStr[strings.Index(tmpStr, "resident:")+9 : strings.Index(tmpStr, "KiB")]
-			memUse = strings.TrimFunc(memUse, func(r rune) bool { return !unicode.IsDigit(r) })
-			var err error
-			langs[i].MemUse, err = strconv.ParseInt(memUse, 10, 32)
-			if err != nil {
-				fmt.Printf("Error parsing memory use to integer for language %v\n", lang.Name)
-			}
-		}
-		fmt.Printf("The implementation in language %v compiled in %v seconds and ran with an average framerate of %v frames per second and an average cpu time of %v seconds per frame, using %v KiB of memory.\n", lang.Name, lang.CmplTime, fps, cpuTime, memUse)
+func orNA(v float64) string { // Zero marks a result that couldn't be read
+	if v == 0 {
+		return "N/A"
 	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
 }
 
 func measureLangSizes() {
@@ -193,8 +1755,8 @@ func measureLangSizes() {
 		if lang.Loaded == false {
 			continue
 		}
-		runCommand("bzip2 -k " + lang.SourceName)
-		size, err := runCommand("du -b " + lang.SourceName + ".bz2")
+		runCommand(lang.Dir, "bzip2 -k "+lang.SourceName)
+		size, err := runCommand(lang.Dir, "du -b "+lang.SourceName+".bz2")
 		if err != nil {
 			fmt.Printf("Error of: %v when reading compressed source file size for language %v\n", err, lang.Name)
 			continue
@@ -205,9 +1767,9 @@ func measureLangSizes() {
 			continue
 		}
 		langs[i].CompSize = intSize
-		_, _ = runCommand("rm " + lang.SourceName + ".bz2")
+		_, _ = runCommand(lang.Dir, "rm "+lang.SourceName+".bz2")
 
-		sourceBytes, err := ioutil.ReadFile(lang.SourceName)
+		sourceBytes, err := ioutil.ReadFile(filepath.Join(lang.Dir, lang.SourceName))
 		if err != nil {
 			fmt.Printf("Error of: %v when reading source file content for language %v, unable to count lines and characters.\n", err, lang.Name)
 			continue
@@ -244,18 +1806,23 @@ func calcLangStats() {
 		if lang.Loaded == false {
 			continue
 		}
-		langs[i].PcntMaxFps = lang.FPS / maxFps
-		langs[i].PcntMinCpu = minCpuTime / lang.CpuTime
+		if maxFps > 0 { // Leave the percentages at zero rather than NaN or infinite when a result couldn't be read
+			langs[i].PcntMaxFps = lang.FPS / maxFps
+		}
+		if lang.CpuTime > 0 {
+			langs[i].PcntMinCpu = minCpuTime / lang.CpuTime
+		}
 		langs[i].Compiler = strings.Split(lang.Commands, " ")[0]
 	}
 }
 
 type ByFramerate []Lang
+
 func (s ByFramerate) Len() int           { return len(s) }
 func (s ByFramerate) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s ByFramerate) Less(i, j int) bool { return s[i].FPS > s[j].FPS }
 
-func sortLangs(){
+func sortLangs() {
 	sort.Sort(ByFramerate(langs))
 }
 
@@ -269,14 +1836,41 @@ func putResultsInHtmlTable() {
 		<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{printf "%.2f" .PcntMaxFps}}</em></span></td>
 		<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{printf "%.5f" .CpuTime}}</em></span></td>
 		<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{printf "%.2f" .PcntMinCpu}}</em></span></td>
+		<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{if .GpuTime}}{{printf "%.5f" .GpuTime}}{{else}}N/A{{end}}</em></span></td>
 		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{.MemUse}}</em></span></td>
+		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{printf "%.2f" .Usage.UserTime}}</em></span></td>
+		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{printf "%.2f" .Usage.SysTime}}</em></span></td>
+		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{printf "%.0f" .Usage.VolCtxSw}} / {{printf "%.0f" .Usage.InvolCtxSw}}</em></span></td>
+		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{printf "%.0f" .Usage.MinFlt}} / {{printf "%.0f" .Usage.MajFlt}}</em></span></td>
+		<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{with .Tree.Dominant}}{{if .Comm}}{{.Comm}} ({{printf "%.2f" .CPUTime}} s){{else}}N/A{{end}}{{end}} of {{.Tree.Processes}}</em></span></td>
 		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{.CompSize}}</em></span></td>
 		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{.LOC}}</em></span></td>
 		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{.NumChars}}</em></span></td>
 		<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{.ExeSize}}</em></span></td>
 		</tr>
 	`)
-	table := `
+	table := "\n\t\t<p>Results from " + html.EscapeString(host.String()) + "</p>"
+	table += "\n\t\t<p>" + html.EscapeString("Runs scheduled "+scheduleDescription()+", in the order "+strings.Join(runOrder, ", ")) + "</p>"
+	if compileConcurrency > 1 {
+		table += fmt.Sprintf("\n\t\t<p>Up to %v languages compiled at once, so compile times include contention.</p>", compileConcurrency)
+	}
+	for _, lang := range langs {
+		if timeouts := describeTimeouts(lang); timeouts != "" {
+			table += "\n\t\t<p>" + html.EscapeString(lang.Name+" "+timeouts) + "</p>"
+		}
+	}
+	for _, lang := range langs {
+		if lang.Loaded == true && len(lang.Runs) > 0 && lang.Runs[0].Placement != (Placement{}) {
+			table += "\n\t\t<p>" + html.EscapeString(lang.Name+" ran on "+lang.Runs[0].Placement.String()) + "</p>"
+		}
+	}
+	for _, lang := range langs {
+		if lang.Loaded == false || len(lang.Environment) == 0 {
+			continue
+		}
+		table += "\n\t\t<p>" + html.EscapeString(lang.Name+" ran with "+formatEnvironment(lang.Environment)) + "</p>"
+	}
+	table += `
 		<table width="394" border="1" cellspacing="1" cellpadding="1">
 		<colgroup>
 			<col span="4" width="81" />
@@ -291,7 +1885,13 @@ func putResultsInHtmlTable() {
 			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>% Fastest</em></span></td>
 			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>CPU time</em></span></td>
 			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>% Fastest</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Render time</em></span></td>
 			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>Resident mem use (KiB)</em></span></td>
+			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>User CPU time (s)</em></span></td>
+			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>System CPU time (s)</em></span></td>
+			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>Context switches (vol. / invol.)</em></span></td>
+			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>Page faults (minor / major)</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Busiest process (CPU time) of processes</em></span></td>
 			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>Compressed source size</em></span></td>
 			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>Lines of code</em></span></td>
 			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>Number of characters</em></span></td>
@@ -311,6 +1911,7 @@ func putResultsInHtmlTable() {
 	table = table + `
 		</tbody>
 		</table>`
+	table += statsTable()
 
 	err = ioutil.WriteFile("ResultsTable.html", []byte(table), 0644)
 	if err != nil {
@@ -318,34 +1919,880 @@ func putResultsInHtmlTable() {
 	}
 }
 
-var cflag = flag.Bool("c", true, "Whether to compile")
+// statsTable lays out the spread of each language's metrics over its runs, or returns "" if every language ran only once.
+func statsTable() string {
+	tmpl, err := template.New("stats").Parse(`{{range .Metrics}}
+			<tr>
+			<td style="text-align: center;" width="81" height="17"><span style="color: #000000;"><em>{{$.Name}}</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{.Name}}</em></span></td>
+			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>{{.N}}</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{printf .Format .Mean}}</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{printf .Format .Median}}</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{printf .Format .StdDev}}</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{printf .Format .Min}}</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{printf .Format .Max}}</em></span></td>
+			<td style="text-align: center;" width="120"><span style="color: #000000;"><em>{{printf .Format .CILow}} &ndash; {{printf .Format .CIHigh}}</em></span></td>
+			</tr>{{end}}`)
+	if err != nil {
+		panic(err)
+	}
+	type metric struct {
+		Name   string
+		Format string
+		Stats
+	}
+	table := ""
+	for _, lang := range langs {
+		if lang.Loaded == false || len(lang.Runs) < 2 {
+			continue
+		}
+		var rows bytes.Buffer
+		err = tmpl.Execute(&rows, struct {
+			Name    string
+			Metrics []metric
+		}{lang.Name, []metric{{"Framerate", "%.2f", lang.FPSStats}, {"CPU time", "%.5f", lang.CpuStats}, {"Resident mem use (KiB)", "%.0f", lang.MemStats}}})
+		if err != nil {
+			fmt.Printf("Failed to lay out the statistics for language %v, failing with error %v\n", lang.Name, err)
+		}
+		table += rows.String()
+	}
+	if table == "" {
+		return ""
+	}
+	return `
+		<table border="1" cellspacing="1" cellpadding="1">
+		<tbody>
+			<tr>
+			<td style="text-align: center;" width="81" height="17"><span style="color: #000000;"><em>Language</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Metric</em></span></td>
+			<td style="text-align: center;" width="70"><span style="color: #000000;"><em>Runs</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Mean</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Median</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Std. dev.</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Min</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Max</em></span></td>
+			<td style="text-align: center;" width="120"><span style="color: #000000;"><em>95% confidence interval</em></span></td>
+			</tr>` + table + `
+		</tbody>
+		</table>`
+}
+
+const (
+	StoreSchema  = "particlebench.history"
+	StoreVersion = 1
+)
+
+// StoredResult is one line of the results store: one language's results from one session.
+// Records are only ever appended, so the file holds every session's results in the order they finished.
+type StoredResult struct {
+	Schema      string     `json:"schema"`
+	Version     int        `json:"version"`
+	Session     time.Time  `json:"session"`  // When the session started; the same for every language in it
+	Time        time.Time  `json:"time"`     // When the record was stored
+	Revision    string     `json:"revision"` // git revision of the sources, with "-dirty" if they had uncommitted changes, or "" outside git
+	Host        HostInfo   `json:"host"`
+	Schedule    string     `json:"schedule"`
+	RunOrder    []string   `json:"run_order"`
+	MemInterval float64    `json:"mem_interval"` // Seconds between memory samples, or zero if memory wasn't measured
+	Lang        StoredLang `json:"lang"`
+}
+
+// StoredLang is what the store keeps of a language's results: its measurements and each run's, but not Benchmarker's working state,
+// the runs' raw output, or the percentages that only mean something next to the other languages of the same session.
+type StoredLang struct {
+	Name        string            `json:"name"`
+	Tags        []string          `json:"tags,omitempty"`
+	Loaded      bool              `json:"loaded"` // It compiled, if it needed to, and at least one run succeeded
+	Compiler    string            `json:"compiler,omitempty"`
+	CmplTime    float64           `json:"compile_time"`    // Seconds
+	CmplOutcome string            `json:"compile_outcome"` // "ok", "failed" or "timeout", or "" if it wasn't compiled
+	FPS         float64           `json:"fps"`             // Mean over the runs that reported it, as are CpuTime, GpuTime and MemUse
+	FPSStats    Stats             `json:"fps_stats"`
+	CpuTime     float64           `json:"cpu_time"` // Seconds per frame
+	CpuStats    Stats             `json:"cpu_stats"`
+	GpuTime     float64           `json:"gpu_time"` // Seconds per frame spent rendering and swapping buffers
+	MemUse      int64             `json:"mem_use"`  // Peak resident KiB
+	MemStats    Stats             `json:"mem_stats"`
+	Usage       Usage             `json:"usage"` // Mean over the runs
+	Stalls      int               `json:"stalls"`
+	Environment map[string]string `json:"environment,omitempty"`
+	CompSize    int64             `json:"compressed_source_size"`
+	LOC         int               `json:"lines_of_code"`
+	NumChars    int               `json:"source_chars"`
+	ExeSize     int               `json:"executable_size"`
+	Runs        []StoredRun       `json:"runs"`
+}
+
+// StoredRun is one run of a language, as the store keeps it.
+type StoredRun struct {
+	Repetition  int               `json:"repetition"`
+	Order       int               `json:"order"`
+	Placement   Placement         `json:"placement"`
+	Cooldown    float64           `json:"cooldown"`    // Seconds waited for the machine to cool down first
+	Temperature float64           `json:"temperature"` // Degrees Celsius, or zero if unknown
+	Started     time.Time         `json:"started"`
+	Outcome     string            `json:"outcome"`
+	Format      string            `json:"format"`
+	FPS         float64           `json:"fps"`
+	CpuTime     float64           `json:"cpu_time"`
+	GpuTime     float64           `json:"gpu_time"`
+	MemUse      int64             `json:"mem_use"`
+	Usage       Usage             `json:"usage"`
+	Frames      []float64         `json:"frames"`
+	GpuTimes    []float64         `json:"gpu_times"`
+	Memory      []MemSample       `json:"memory"`
+	Tree        TreeUsage         `json:"tree"`
+	Stalls      int               `json:"stalls"`
+	Environment map[string]string `json:"environment,omitempty"`
+}
+
+func storedLang(lang Lang) StoredLang {
+	stored := StoredLang{Name: lang.Name, Tags: lang.Tags, Loaded: lang.Loaded, Compiler: lang.Compiler, CmplTime: lang.CmplTime,
+		CmplOutcome: lang.CmplOutcome, FPS: lang.FPS, FPSStats: lang.FPSStats, CpuTime: lang.CpuTime, CpuStats: lang.CpuStats,
+		GpuTime: lang.GpuTime, MemUse: lang.MemUse, MemStats: lang.MemStats, Usage: lang.Usage, Stalls: lang.Stalls,
+		Environment: lang.Environment, CompSize: lang.CompSize, LOC: lang.LOC, NumChars: lang.NumChars, ExeSize: lang.ExeSize}
+	for _, run := range lang.Runs {
+		stored.Runs = append(stored.Runs, StoredRun{Repetition: run.Repetition, Order: run.Order, Placement: run.Placement,
+			Cooldown: run.Cooldown.Seconds(), Temperature: run.Temperature, Started: run.Started, Outcome: run.Outcome, Format: run.Format,
+			FPS: run.FPS, CpuTime: run.CpuTime, GpuTime: run.GpuTime, MemUse: run.MemUse, Usage: run.Usage, Frames: run.Frames,
+			GpuTimes: run.GpuTimes, Memory: run.Memory, Tree: run.Tree, Stalls: run.Stalls, Environment: run.Environment})
+	}
+	return stored
+}
+
+// ResultQuery selects records from the store; its zero value selects them all.
+type ResultQuery struct {
+	Langs    []string  // Names or globs of the languages, case-insensitively
+	Since    time.Time // Sessions that started at or after this
+	Until    time.Time // Sessions that started before this
+	Revision string    // Revisions starting with this
+	Last     int       // Only the records of the last this many matching sessions
+}
+
+func (q ResultQuery) matches(rec StoredResult) bool {
+	if !q.Since.IsZero() && rec.Session.Before(q.Since) || !q.Until.IsZero() && !rec.Session.Before(q.Until) {
+		return false
+	}
+	if !strings.HasPrefix(rec.Revision, q.Revision) {
+		return false
+	}
+	if len(q.Langs) == 0 {
+		return true
+	}
+	for _, pattern := range q.Langs {
+		if ok, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(rec.Lang.Name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// storeResults appends a record for every language, including those that failed, to the store at path.
+func storeResults(path string) error {
+	now := time.Now().UTC()
+	revision := sourceRevision(filepath.Dir(*manifestFlag))
+	var buf bytes.Buffer
+	for _, lang := range langs {
+		line, err := json.Marshal(StoredResult{Schema: StoreSchema, Version: StoreVersion, Session: sessionStart, Time: now,
+			Revision: revision, Host: host, Schedule: scheduleDescription(), RunOrder: runOrder, MemInterval: memInterval.Seconds(), Lang: storedLang(lang)})
+		if err != nil {
+			fmt.Printf("Failed to encode the results of language %v for the store, failing with error %v\n", lang.Name, err)
+			continue
+		}
+		buf.Write(append(line, '\n'))
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes()) // In one write, so a session's records stay together
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func sourceRevision(dir string) string { // The git revision checked out in dir, or "" if it isn't in a git repository
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	revision := strings.TrimSpace(string(out))
+	if status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--untracked-files=no").Output(); err == nil && len(bytes.TrimSpace(status)) > 0 {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// queryResults reads the records in the store at path that match q, oldest first. Lines it can't understand are reported and skipped.
+func queryResults(path string, q ResultQuery) ([]StoredResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var found []StoredResult
+	r := bufio.NewReader(f) // Not a Scanner, since a record with long frame series can be megabytes
+	for lineNum := 1; ; lineNum++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var rec StoredResult
+			if err := json.Unmarshal(line, &rec); err != nil {
+				fmt.Printf("%v:%v: skipping unreadable record: %v\n", path, lineNum, err)
+			} else if rec.Schema != StoreSchema || rec.Version > StoreVersion {
+				fmt.Printf("%v:%v: skipping record of schema %v version %v\n", path, lineNum, rec.Schema, rec.Version)
+			} else if q.matches(rec) {
+				found = append(found, rec)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return found, err
+		}
+	}
+	if q.Last > 0 {
+		sessions := 0
+		for i := len(found) - 1; i >= 0; i-- {
+			if i == len(found)-1 || !found[i].Session.Equal(found[i+1].Session) {
+				sessions++
+			}
+			if sessions > q.Last {
+				found = found[i+1:]
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// queryCommand is "go run Benchmarker.go query [flags]", which prints the stored results matching its flags.
+func queryCommand(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	store := fs.String("store", *storePath, "The results store to read")
+	langList := fs.String("lang", "", "Comma-separated names or globs of the languages to show")
+	since := fs.String("since", "", "Only sessions that started at or after this date or RFC 3339 time")
+	until := fs.String("until", "", "Only sessions that started before this date or RFC 3339 time")
+	revision := fs.String("revision", "", "Only results from source revisions starting with this")
+	last := fs.Int("last", 0, "Only the last this many matching sessions")
+	asJSON := fs.Bool("json", false, "Print the matching records as JSON Lines instead of a summary")
+	fs.Parse(args)
+	q := ResultQuery{Langs: splitList(*langList), Revision: *revision, Last: *last}
+	var err error
+	if q.Since, err = parseQueryTime(*since); err != nil {
+		return err
+	}
+	if q.Until, err = parseQueryTime(*until); err != nil {
+		return err
+	}
+	found, err := queryResults(*store, q)
+	if err != nil {
+		return err
+	}
+	for _, rec := range found {
+		if *asJSON {
+			line, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(line))
+			continue
+		}
+		revision := rec.Revision
+		if len(revision) > 12 && !strings.HasSuffix(revision, "-dirty") {
+			revision = revision[:12]
+		}
+		fmt.Printf("%v  %-12v  %-20v  %v runs  framerate %v  cpu time %v  memory %v KiB\n", rec.Session.Local().Format("2006-01-02 15:04:05"),
+			revision, rec.Lang.Name, len(rec.Lang.Runs), orNA(rec.Lang.FPS), orNA(rec.Lang.CpuTime), orNA(float64(rec.Lang.MemUse)))
+	}
+	return nil
+}
+
+// A compared metric: how to read it from a language's results, and whether a bigger value is better.
+type compareMetric struct {
+	Name         string
+	Get          func(StoredLang) float64
+	HigherBetter bool
+	Threshold    *float64                // Largest relative worsening that isn't a regression; negative to not check it
+	Measured     func(StoredResult) bool // Whether the session tried to measure it, so a zero means it failed; nil if it always does
+}
+
+// compareCommand is "go run Benchmarker.go compare [flags] baseline.jsonl [current.jsonl]". It compares the last session in each store,
+// taking current from -store if it isn't given, and returns how many regressions it found.
+func compareCommand(args []string) (int, error) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	metrics := []compareMetric{
+		{"Framerate", func(l StoredLang) float64 { return l.FPS }, true, fs.Float64("fps", 0.05, "Largest relative drop in framerate that isn't a regression"), nil},
+		{"CPU time", func(l StoredLang) float64 { return l.CpuTime }, false, fs.Float64("cpu", 0.05, "Largest relative rise in cpu time per frame that isn't a regression"), nil},
+		{"Render time", func(l StoredLang) float64 { return l.GpuTime }, false, fs.Float64("gpu", 0.10, "Largest relative rise in render time per frame that isn't a regression"), nil},
+		{"Memory", func(l StoredLang) float64 { return float64(l.MemUse) }, false, fs.Float64("mem", 0.10, "Largest relative rise in peak resident memory that isn't a regression"),
+			func(rec StoredResult) bool { return rec.MemInterval > 0 }}, // -meminterval=0 turns it off
+		{"Compile time", func(l StoredLang) float64 { return l.CmplTime }, false, fs.Float64("compile", 0.25, "Largest relative rise in compile time that isn't a regression"),
+			func(rec StoredResult) bool { return rec.Lang.CmplOutcome != "" }}, // Interpreted, or run with -c=false
+	}
+	langList := fs.String("lang", "", "Comma-separated names or globs of the languages to compare; default all")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go run Benchmarker.go compare [flags] baseline.jsonl [current.jsonl]\nThresholds are fractions, so 0.05 is 5%; give a negative one to not check that metric.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 0, errors.New("no baseline given")
+	}
+	currentPath := *storePath
+	if fs.NArg() > 1 {
+		currentPath = fs.Arg(1)
+	}
+	q := ResultQuery{Langs: splitList(*langList), Last: 1}
+	baseline, err := queryResults(fs.Arg(0), q)
+	if err != nil {
+		return 0, err
+	}
+	current, err := queryResults(currentPath, q)
+	if err != nil {
+		return 0, err
+	}
+	if len(baseline) == 0 || len(current) == 0 {
+		return 0, fmt.Errorf("no results to compare in %v or %v", fs.Arg(0), currentPath)
+	}
+	fmt.Printf("Comparing the session of %v (revision %v) against the baseline of %v (revision %v).\n",
+		current[0].Session.Local().Format("2006-01-02 15:04:05"), orUnknown(current[0].Revision),
+		baseline[0].Session.Local().Format("2006-01-02 15:04:05"), orUnknown(baseline[0].Revision))
+
+	byName := map[string]StoredResult{}
+	for _, rec := range current {
+		byName[rec.Lang.Name] = rec
+	}
+	regressions := 0
+	fmt.Printf("%-20v  %-12v  %14v  %14v  %9v  %v\n", "Language", "Metric", "Baseline", "Current", "Change", "Status")
+	for _, rec := range baseline {
+		base := rec.Lang
+		curRec, ok := byName[base.Name]
+		cur := curRec.Lang
+		delete(byName, base.Name)
+		switch {
+		case !base.Loaded:
+			fmt.Printf("%-20v  %-12v  %14v  %14v  %9v  %v\n", base.Name, "-", "failed", "-", "", "not in baseline")
+			continue
+		case !ok:
+			fmt.Printf("%-20v  %-12v  %14v  %14v  %9v  %v\n", base.Name, "-", "ran", "missing", "", "REGRESSION")
+			regressions++
+			continue
+		case !cur.Loaded:
+			fmt.Printf("%-20v  %-12v  %14v  %14v  %9v  %v\n", base.Name, "-", "ran", "failed", "", "REGRESSION")
+			regressions++
+			continue
+		}
+		for _, m := range metrics {
+			was, is := m.Get(base), m.Get(cur)
+			if was == 0 { // The baseline didn't report it, so there's nothing to compare with
+				continue
+			}
+			if is == 0 && m.Measured != nil && !m.Measured(curRec) { // Deliberately left out, such as with -c=false, so not a failure
+				fmt.Printf("%-20v  %-12v  %14.6g  %14v  %9v  %v\n", base.Name, m.Name, was, "-", "", "not measured")
+				continue
+			}
+			if is == 0 { // It stopped being reported, which mustn't slip past the gate
+				status := "REGRESSION"
+				if *m.Threshold < 0 {
+					status = "not checked"
+				} else {
+					regressions++
+				}
+				fmt.Printf("%-20v  %-12v  %14.6g  %14v  %9v  %v\n", base.Name, m.Name, was, "missing", "", status)
+				continue
+			}
+			change := (is - was) / was
+			worsening := change
+			if m.HigherBetter {
+				worsening = -change
+			}
+			status := "ok"
+			switch {
+			case *m.Threshold >= 0 && worsening > *m.Threshold:
+				status = "REGRESSION"
+				regressions++
+			case *m.Threshold >= 0 && worsening < -*m.Threshold:
+				status = "improved"
+			case *m.Threshold < 0:
+				status = "not checked"
+			}
+			fmt.Printf("%-20v  %-12v  %14.6g  %14.6g  %+8.1f%%  %v\n", base.Name, m.Name, was, is, change*100, status)
+		}
+	}
+	for _, rec := range current {
+		if _, ok := byName[rec.Lang.Name]; ok {
+			fmt.Printf("%-20v  %-12v  %14v  %14v  %9v  %v\n", rec.Lang.Name, "-", "-", "ran", "", "new")
+		}
+	}
+	return regressions, nil
+}
+
+// A trended metric: its name, the suffix of its graph file, how to read it and how to print it.
+type trendMetric struct {
+	Name   string
+	Suffix string
+	Format string
+	Get    func(StoredLang) float64
+}
+
+var trendMetrics = []trendMetric{
+	{"Framerate", "fps", "%.2f", func(l StoredLang) float64 { return l.FPS }},
+	{"CPU time", "cpu", "%.5f", func(l StoredLang) float64 { return l.CpuTime }},
+	{"Resident mem use (KiB)", "mem", "%.0f", func(l StoredLang) float64 { return float64(l.MemUse) }},
+	{"Compile time", "compile", "%.4f", func(l StoredLang) float64 { return l.CmplTime }},
+}
+
+// trendCommand is "go run Benchmarker.go trend [flags]". It graphs how each language's results changed over the sessions in the store,
+// oldest at the top, and lays out the changes between each session and the one before it in an HTML table.
+func trendCommand(args []string) error {
+	fs := flag.NewFlagSet("trend", flag.ExitOnError)
+	store := fs.String("store", *storePath, "The results store to read")
+	langList := fs.String("lang", "", "Comma-separated names or globs of the languages to report on")
+	since := fs.String("since", "", "Only sessions that started at or after this date or RFC 3339 time")
+	until := fs.String("until", "", "Only sessions that started before this date or RFC 3339 time")
+	last := fs.Int("last", 0, "Only the last this many sessions")
+	out := fs.String("out", "TrendReport.html", "File to write the table of changes to; the graphs are saved beside it")
+	fs.Parse(args)
+	q := ResultQuery{Langs: splitList(*langList), Last: *last}
+	var err error
+	if q.Since, err = parseQueryTime(*since); err != nil {
+		return err
+	}
+	if q.Until, err = parseQueryTime(*until); err != nil {
+		return err
+	}
+	found, err := queryResults(*store, q)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("no results in %v", *store)
+	}
+	var names []string
+	history := map[string][]StoredResult{}
+	for _, rec := range found {
+		if _, ok := history[rec.Lang.Name]; !ok {
+			names = append(names, rec.Lang.Name)
+		}
+		history[rec.Lang.Name] = append(history[rec.Lang.Name], rec)
+	}
+
+	tmpl, err := template.New("trend").Parse(`{{range .}}
+			<tr>
+			<td style="text-align: center;" width="81" height="17"><span style="color: #000000;"><em>{{.Name}}</em></span></td>
+			<td style="text-align: center;" width="120"><span style="color: #000000;"><em>{{.Session}}</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{.Revision}}</em></span></td>
+			<td style="text-align: center;" width="120"><span style="color: #000000;"><em>{{.Toolchain}}</em></span></td>{{range .Cells}}
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>{{.}}</em></span></td>{{end}}
+			</tr>{{end}}`)
+	if err != nil {
+		panic(err)
+	}
+	type row struct {
+		Name, Session, Revision, Toolchain string
+		Cells                              []string
+	}
+	dir := filepath.Dir(*out)
+	table := "\n\t\t<p>" + html.EscapeString(fmt.Sprintf("Results from %v sessions between %v and %v in %v", countSessions(found),
+		found[0].Session.Local().Format("2006-01-02 15:04"), found[len(found)-1].Session.Local().Format("2006-01-02 15:04"), *store)) + "</p>"
+	for _, name := range names {
+		var graphs []string
+		for _, m := range trendMetrics {
+			var series []float64
+			for _, rec := range history[name] {
+				if v := m.Get(rec.Lang); rec.Lang.Loaded && v != 0 {
+					series = append(series, v)
+				}
+			}
+			if len(series) == 0 {
+				continue
+			}
+			graphFile := filepath.Join(dir, name+".trend."+m.Suffix+".ppm")
+			if err := graphSeries(graphFile, series, "-relative"); err != nil {
+				fmt.Printf("Graphing the %v trend for language %v failed with error of %v\n", strings.ToLower(m.Name), name, err)
+				continue
+			}
+			graphs = append(graphs, filepath.Base(graphFile))
+		}
+		if len(graphs) > 0 {
+			fmt.Printf("Graphed %v over %v sessions to %v.\n", name, len(history[name]), strings.Join(graphs, ", "))
+			table += "\n\t\t<p>" + html.EscapeString(name+" is graphed in "+strings.Join(graphs, ", ")) + "</p>"
+		}
+	}
+
+	table += `
+		<table width="394" border="1" cellspacing="1" cellpadding="1">
+		<tbody>
+			<tr>
+			<td style="text-align: center;" width="81" height="17"><span style="color: #000000;"><em>Language</em></span></td>
+			<td style="text-align: center;" width="120"><span style="color: #000000;"><em>Session</em></span></td>
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>Revision</em></span></td>
+			<td style="text-align: center;" width="120"><span style="color: #000000;"><em>Toolchain</em></span></td>`
+	for _, m := range trendMetrics {
+		table += `
+			<td style="text-align: center;" width="81"><span style="color: #000000;"><em>` + html.EscapeString(m.Name) + ` (change)</em></span></td>`
+	}
+	table += `
+			</tr>`
+	for _, name := range names {
+		var rows []row
+		var prev *StoredLang // The last session the language ran in
+		for _, rec := range history[name] {
+			lang := rec.Lang
+			r := row{Name: name, Session: rec.Session.Local().Format("2006-01-02 15:04"), Revision: orUnknown(rec.Revision), Toolchain: toolchain(lang)}
+			if len(r.Revision) > 12 && !strings.HasSuffix(r.Revision, "-dirty") {
+				r.Revision = r.Revision[:12]
+			}
+			for _, m := range trendMetrics {
+				v := m.Get(lang)
+				switch {
+				case !lang.Loaded:
+					r.Cells = append(r.Cells, "failed")
+				case v == 0:
+					r.Cells = append(r.Cells, "N/A")
+				case prev == nil || m.Get(*prev) == 0:
+					r.Cells = append(r.Cells, fmt.Sprintf(m.Format, v))
+				default:
+					was := m.Get(*prev)
+					r.Cells = append(r.Cells, fmt.Sprintf(m.Format+" (%+.1f%%)", v, (v-was)/was*100))
+				}
+			}
+			if lang.Loaded {
+				prev = &lang
+			}
+			rows = append(rows, r)
+		}
+		var execRows bytes.Buffer
+		if err := tmpl.Execute(&execRows, rows); err != nil {
+			return err
+		}
+		table += execRows.String()
+	}
+	table += `
+		</tbody>
+		</table>`
+	if err := ioutil.WriteFile(*out, []byte(table), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote the changes between sessions to %v.\n", *out)
+	return nil
+}
+
+func countSessions(records []StoredResult) int {
+	sessions := map[time.Time]bool{}
+	for _, rec := range records {
+		sessions[rec.Session] = true
+	}
+	return len(sessions)
+}
+
+// toolchain names what built and ran a language: the versions it reported, or else its compiler command.
+func toolchain(lang StoredLang) string {
+	var versions []string
+	for name, value := range lang.Environment {
+		if strings.HasSuffix(name, "version") {
+			versions = append(versions, name+"="+value)
+		}
+	}
+	if len(versions) == 0 {
+		return lang.Compiler
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, " ")
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+func parseQueryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+var (
+	cflag          = flag.Bool("c", true, "Whether to compile")
+	storePath      = flag.String("store", "ResultsHistory.jsonl", "JSON Lines file to append every session's results to; empty to not keep them")
+	scratchRoot    = flag.String("scratch", "scratch", "Directory to give each language a build and run directory in; empty to build and run where the sources are")
+	telemetryFlag  = flag.Bool("telemetry", false, "Show live progress from implementations that stream telemetry; this slows their measured frames, so leave it off for results")
+	cpusFlag       = flag.String("cpus", "", "CPUs to pin every run to, as a list such as 0-3,6; a language's manifest entry can give its own")
+	niceFlag       = flag.Int("nice", 0, "Nice value to run every language with, from -20 (needs privileges) to 19; a language's manifest entry can give its own")
+	memInterval    = flag.Duration("meminterval", time.Second, "How often to sample the memory and cpu time of each run's process tree; 0 to not sample it, leaving peak memory unmeasured")
+	stallTime      = flag.Duration("stall", 15*time.Second, "How long a language streaming telemetry may go without a frame before it's reported as stalled")
+	compileTimeout = flag.Duration("compiletimeout", 10*time.Minute, "How long a language may take to compile before it's killed; 0 for no limit")
+	runTimeout     = flag.Duration("runtimeout", 5*time.Minute, "How long a run may take before it's killed, unless the manifest gives the language its own timeout; 0 for no limit")
+	compileJobs    = flag.Int("compilejobs", 1, "How many languages to compile at once; more than one is quicker, but inflates compile times with contention")
+	repetitions    = flag.Int("reps", 1, "How many times to run each language")
+	scheduleFlag   = flag.String("schedule", "sequential", "The order of the runs: "+strings.Join(scheduleStrategies, ", "))
+	cooldown       = flag.String("cooldown", "adaptive", "How to let the machine cool down before each run: adaptive waits for the temperature and load to settle, fixed sleeps for the full wait")
+	maxTemp        = flag.Float64("maxtemp", 50, "Adaptive cooldown waits until the hottest thermal zone is below this many degrees Celsius")
+	maxLoad        = flag.Float64("maxload", 0.5, "Adaptive cooldown waits until the one-minute load average is below this")
+	maxWait        = flag.Duration("maxwait", WaitTime*time.Second, "The longest adaptive cooldown waits before running anyway")
+	seed           = flag.Int64("seed", 0, "Seed for -schedule=shuffle; zero picks one from the clock, which is printed so the order can be repeated")
+)
+
+var errTimeout = errors.New("timed out")
+
+// Placement is where and at what priority a command runs.
+type Placement struct {
+	CPUs string `json:"cpus"` // CPU list such as "0-3,6", or "" for any CPU
+	Nice int    `json:"nice"`
+}
+
+func (p Placement) String() string {
+	cpus := p.CPUs
+	if cpus == "" {
+		cpus = "any"
+	}
+	return fmt.Sprintf("CPUs %v, nice %v", cpus, p.Nice)
+}
+
+// startPlaced starts cmd with the placement's affinity and nice value. Linux keeps both per thread and a child inherits them
+// from the thread that forked it, so they're set on a thread of our own that starts cmd and is then thrown away.
+func startPlaced(cmd *exec.Cmd, placement Placement) error {
+	if placement == (Placement{}) {
+		return cmd.Start()
+	}
+	result := make(chan error)
+	go func() {
+		runtime.LockOSThread() // Never unlocked, so the thread exits with the goroutine instead of running others with our settings
+		if placement.CPUs != "" {
+			cpus, err := parseCPUList(placement.CPUs)
+			if err != nil {
+				result <- err
+				return
+			}
+			var mask [1024 / 64]uint64
+			for _, cpu := range cpus {
+				mask[cpu/64] |= 1 << uint(cpu%64)
+			}
+			_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+			if errno != 0 {
+				result <- fmt.Errorf("setting the affinity to CPUs %v: %v", placement.CPUs, errno)
+				return
+			}
+		}
+		if placement.Nice != 0 {
+			if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, placement.Nice); err != nil { // Who 0 is this thread
+				result <- fmt.Errorf("setting nice %v: %v", placement.Nice, err)
+				return
+			}
+		}
+		result <- cmd.Start()
+	}()
+	return <-result
+}
+
+func parseCPUList(list string) ([]int, error) { // Parses a list such as "0-3,6", as in /sys/devices/system/cpu/online
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		last := first
+		if err == nil && len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+		}
+		if err != nil || first < 0 || last < first || last >= 1024 {
+			return nil, fmt.Errorf("invalid cpu range %q in %q", part, list)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+func runCommand(dir, command string, env ...string) (string, error) { // Runs command in a shell in dir, with env added to the environment
+	return runCommandTimeout(0, dir, command, env...)
+}
+
+// runCommandTimeout is runCommand, but kills the shell and everything it started if it takes longer than timeout, returning errTimeout
+// and whatever output there was. A timeout of zero means no limit.
+func runCommandTimeout(timeout time.Duration, dir, command string, env ...string) (string, error) {
+	out, _, err := runCommandUsage(timeout, Placement{}, dir, command, nil, env...)
+	return out, err
+}
+
+const launcherShell = "sh" // What runs each command's script, and so the root of every run's process tree
 
-func runCommand(command string) (string, error) {
-	script := "#!/bin/bash\n" + command
-	err := ioutil.WriteFile("command.sh", []byte(script), 0644)
+// runCommandUsage is runCommandTimeout, also returning the resources the command used, and starting it with the given placement.
+// If started isn't nil, it's called with the shell's pid once it's running.
+func runCommandUsage(timeout time.Duration, placement Placement, dir, command string, started func(pid int), env ...string) (string, Usage, error) {
+	var usage Usage
+	script, err := ioutil.TempFile("", "command*.sh") // One per command, so commands can run concurrently
+	if err == nil {
+		defer os.Remove(script.Name())
+		_, err = script.WriteString("#!/bin/bash\n" + command)
+		if err2 := script.Close(); err == nil {
+			err = err2
+		}
+	}
 	if err != nil {
 		fmt.Printf("Failed to write command %v, with error: %v\n", command, err)
-		return "", err
+		return "", usage, err
+	}
+	scriptPath := script.Name()
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, launcherShell, scriptPath)
+	cmd.Dir = dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} // Its own process group, so a timeout can kill the whole tree
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second // In case something escaped the group and still holds the output open
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err2 := startPlaced(cmd, placement)
+	if err2 == nil {
+		if started != nil {
+			started(cmd.Process.Pid)
+		}
+		err2 = cmd.Wait()
+	}
+	cmdOutput := output.Bytes()
+	if cmd.ProcessState != nil {
+		if ru, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+			usage = usageFrom(ru)
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return string(cmdOutput), usage, errTimeout
 	}
-	cmdOutput, err2 := exec.Command("sh", "command.sh").CombinedOutput()
 	if err2 != nil {
 		fmt.Printf("Failed to exec command %v, failing with error %v: %v\n", command, err2, string(cmdOutput))
-		return "", err2
+		return string(cmdOutput), usage, err2
 	}
-	return string(cmdOutput), nil
+	return string(cmdOutput), usage, nil
 }
 
 func main() {
 	flag.Parse()
+	if flag.Arg(0) == "convert" { // convert [legacy.dat [manifest.json]]
+		from, to := langFile, manifestFile
+		if flag.NArg() > 1 {
+			from = flag.Arg(1)
+		}
+		if flag.NArg() > 2 {
+			to = flag.Arg(2)
+		}
+		if err := convertManifest(from, to); err != nil {
+			fmt.Println("Conversion failed with error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "query" { // query [-lang names] [-since date] [-until date] [-revision rev] [-last n] [-json]
+		if err := queryCommand(flag.Args()[1:]); err != nil {
+			fmt.Println("Query failed with error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "trend" { // trend [filters]
+		if err := trendCommand(flag.Args()[1:]); err != nil {
+			fmt.Println("Trend report failed with error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "compare" { // compare [thresholds] baseline.jsonl [current.jsonl]
+		regressions, err := compareCommand(flag.Args()[1:])
+		if err != nil {
+			fmt.Println("Comparison failed with error", err)
+			os.Exit(2)
+		}
+		if regressions > 0 {
+			fmt.Printf("Found %v regressions.\n", regressions)
+			os.Exit(1)
+		}
+		fmt.Println("No regressions.")
+		return
+	}
+	if flag.Arg(0) == "validate" { // validate [manifest]
+		path := *manifestFlag
+		if flag.NArg() > 1 {
+			path = flag.Arg(1)
+		}
+		entries, err := readManifest(path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		problems, _ := validateManifest(path, entries)
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("%v: %v languages, no problems found.\n", path, len(entries))
+		return
+	}
+	if *repetitions < 1 {
+		fmt.Println("-reps must be at least 1")
+		os.Exit(1)
+	}
+	if *cpusFlag != "" {
+		if _, err := parseCPUList(*cpusFlag); err != nil {
+			fmt.Println("Bad -cpus:", err)
+			os.Exit(1)
+		}
+	}
+	if *cooldown != "adaptive" && *cooldown != "fixed" {
+		fmt.Printf("Unknown -cooldown %v, expected adaptive or fixed\n", *cooldown)
+		os.Exit(1)
+	}
+	validSchedule := false
+	for _, strategy := range scheduleStrategies {
+		validSchedule = validSchedule || *scheduleFlag == strategy
+	}
+	if !validSchedule {
+		fmt.Printf("Unknown -schedule %v, expected one of %v\n", *scheduleFlag, strings.Join(scheduleStrategies, ", "))
+		os.Exit(1)
+	}
+	if *seed == 0 && *scheduleFlag == "shuffle" {
+		*seed = time.Now().UnixNano()
+		fmt.Printf("Shuffling the runs with -seed=%v.\n", *seed)
+	}
+	sessionStart = time.Now().UTC()
+	host = readHostInfo()
+	fmt.Println("Benchmarking on", host)
 	loadLangs()
+	if *scratchRoot != "" {
+		prepareScratch(*scratchRoot)
+	}
 	var cmp bool = *cflag
 	if cmp == true {
 		compileLangs()
 	}
 	runLangs()
+	parseLangs()
 	graphLangs()
 	printLangs()
 	measureLangSizes()
 	calcLangStats()
 	putResultsInHtmlTable()
+	if *storePath != "" {
+		if err := storeResults(*storePath); err != nil {
+			fmt.Printf("Failed to add the results to %v, failing with error %v\n", *storePath, err)
+		}
+	}
 }
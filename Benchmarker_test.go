@@ -0,0 +1,687 @@
+/*	Tests for Benchmarker.go, run with "go test Benchmarker.go Benchmarker_test.go".
+	Those that read procfs and sysfs point -procroot and -sysroot at fake trees built in a temporary directory.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates each of files, relative to root, with its contents.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fakeStat is the contents of /proc/<pid>/stat for a process with the given command, parent, group and cpu ticks.
+func fakeStat(pid int, comm string, ppid, pgrp int, utime, stime int64) string {
+	return strings.Join([]string{strconv.Itoa(pid), "(" + comm + ")", "S", strconv.Itoa(ppid), strconv.Itoa(pgrp), "0 0 -1 4194304 0 0 0 0",
+		strconv.Itoa(int(utime)), strconv.Itoa(int(stime)), "0 0 20 0 1 0"}, " ")
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6*math.Max(1, math.Abs(b))
+}
+
+func nearAll(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !near(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSummarise(t *testing.T) {
+	for _, test := range []struct {
+		samples []float64
+		want    Stats
+	}{
+		{nil, Stats{}},
+		{[]float64{5}, Stats{N: 1, Mean: 5, Median: 5, Min: 5, Max: 5, CILow: 5, CIHigh: 5}},
+		{[]float64{4, 1, 3, 2}, Stats{N: 4, Mean: 2.5, Median: 2.5, StdDev: math.Sqrt(5.0 / 3), Min: 1, Max: 4,
+			CILow: 2.5 - 3.182*math.Sqrt(5.0/3)/2, CIHigh: 2.5 + 3.182*math.Sqrt(5.0/3)/2}},
+		{[]float64{7, 1, 4}, Stats{N: 3, Mean: 4, Median: 4, StdDev: 3, Min: 1, Max: 7,
+			CILow: 4 - 4.303*3/math.Sqrt(3), CIHigh: 4 + 4.303*3/math.Sqrt(3)}},
+	} {
+		got := summarise(test.samples)
+		gotVals := []float64{float64(got.N), got.Mean, got.Median, got.StdDev, got.Min, got.Max, got.CILow, got.CIHigh}
+		wantVals := []float64{float64(test.want.N), test.want.Mean, test.want.Median, test.want.StdDev, test.want.Min, test.want.Max, test.want.CILow, test.want.CIHigh}
+		for i := range gotVals {
+			if !near(gotVals[i], wantVals[i]) {
+				t.Errorf("summarise(%v) = %+v, want %+v", test.samples, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestTCritical95(t *testing.T) {
+	for _, test := range []struct {
+		df   int
+		want float64
+	}{
+		{1, 12.706}, {2, 4.303}, {10, 2.228}, {30, 2.042}, {31, 2.042}, {39, 2.042}, {40, 2.021}, {59, 2.021},
+		{60, 2.000}, {119, 2.000}, {120, 1.980}, {1000, 1.980},
+	} {
+		if got := tCritical95(test.df); got != test.want {
+			t.Errorf("tCritical95(%v) = %v, want %v", test.df, got, test.want)
+		}
+	}
+}
+
+func TestScheduleRuns(t *testing.T) {
+	loaded := []int{0, 2, 3}
+	for _, test := range []struct {
+		strategy string
+		reps     int
+		want     []int
+	}{
+		{"sequential", 2, []int{0, 0, 2, 2, 3, 3}},
+		{"roundrobin", 2, []int{0, 2, 3, 0, 2, 3}},
+		{"sequential", 1, []int{0, 2, 3}},
+		{"roundrobin", 0, nil},
+	} {
+		if got := scheduleRuns(test.strategy, loaded, test.reps, 1); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("scheduleRuns(%v, %v, %v) = %v, want %v", test.strategy, loaded, test.reps, got, test.want)
+		}
+	}
+	shuffled := scheduleRuns("shuffle", loaded, 4, 42)
+	if again := scheduleRuns("shuffle", loaded, 4, 42); !reflect.DeepEqual(shuffled, again) {
+		t.Errorf("shuffling with the same seed gave %v, then %v", shuffled, again)
+	}
+	counts := map[int]int{}
+	for _, i := range shuffled {
+		counts[i]++
+	}
+	if !reflect.DeepEqual(counts, map[int]int{0: 4, 2: 4, 3: 4}) {
+		t.Errorf("shuffle ran the languages %v times each, not 4", counts)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	for _, test := range []struct {
+		list string
+		want []int
+		ok   bool
+	}{
+		{"0", []int{0}, true},
+		{"0-3,6", []int{0, 1, 2, 3, 6}, true},
+		{" 1 , 4-5", []int{1, 4, 5}, true},
+		{"2-2", []int{2}, true},
+		{"", nil, false},
+		{"3-1", nil, false},
+		{"-1", nil, false},
+		{"1,,2", nil, false},
+		{"a-b", nil, false},
+		{"1024", nil, false},
+	} {
+		got, err := parseCPUList(test.list)
+		if (err == nil) != test.ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseCPUList(%q) = %v, %v; want %v, ok %v", test.list, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestCPUTemperature(t *testing.T) {
+	defer func(old string) { *sysRoot = old }(*sysRoot)
+	for _, test := range []struct {
+		name  string
+		zones map[string]string
+		want  float64
+		ok    bool
+	}{
+		{"hottest", map[string]string{"thermal_zone0/temp": "45000\n", "thermal_zone1/temp": "61500\n", "thermal_zone2/temp": "38000"}, 61.5, true},
+		{"unwired and unreadable", map[string]string{"thermal_zone0/temp": "0", "thermal_zone1/temp": "-", "thermal_zone2/temp": "52000"}, 52, true},
+		{"no sensors", map[string]string{"thermal_zone0/temp": "0"}, 0, false},
+		{"no zones", map[string]string{"cooling_device0/cur_state": "0"}, 0, false},
+	} {
+		*sysRoot = t.TempDir()
+		files := map[string]string{}
+		for name, contents := range test.zones {
+			files["class/thermal/"+name] = contents
+		}
+		writeTree(t, *sysRoot, files)
+		if got, ok := cpuTemperature(); got != test.want || ok != test.ok {
+			t.Errorf("%v: cpuTemperature() = %v, %v; want %v, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestLoadAverage(t *testing.T) {
+	defer func(old string) { *procRoot = old }(*procRoot)
+	for _, test := range []struct {
+		loadavg string
+		want    float64
+		ok      bool
+	}{
+		{"0.42 0.30 0.20 1/100 1234\n", 0.42, true},
+		{"3.00 2.50 2.00 4/512 99", 3, true},
+		{"", 0, false},
+		{"busy 1 1", 0, false},
+	} {
+		*procRoot = t.TempDir()
+		writeTree(t, *procRoot, map[string]string{"loadavg": test.loadavg})
+		if got, ok := loadAverage(); got != test.want || ok != test.ok {
+			t.Errorf("loadAverage() with %q = %v, %v; want %v, %v", test.loadavg, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestCoolDown(t *testing.T) {
+	defer func(sys, proc, mode string, temp, load float64, wait time.Duration) {
+		*sysRoot, *procRoot, *cooldown, *maxTemp, *maxLoad, *maxWait = sys, proc, mode, temp, load, wait
+	}(*sysRoot, *procRoot, *cooldown, *maxTemp, *maxLoad, *maxWait)
+	*cooldown, *maxTemp, *maxLoad, *maxWait = "adaptive", 50, 0.5, 0 // Never wait, so every case returns at once
+	for _, test := range []struct {
+		name, temp, loadavg string
+	}{
+		{"cool and idle", "40000", "0.10 0.10 0.10 1/100 1"},
+		{"hot", "80000", "0.10 0.10 0.10 1/100 1"},
+		{"loaded", "40000", "2.00 1.00 1.00 1/100 1"},
+		{"no load average", "40000", ""},
+	} {
+		*sysRoot, *procRoot = t.TempDir(), t.TempDir()
+		writeTree(t, *sysRoot, map[string]string{"class/thermal/thermal_zone0/temp": test.temp})
+		if test.loadavg != "" {
+			writeTree(t, *procRoot, map[string]string{"loadavg": test.loadavg})
+		}
+		if waited := coolDown(); waited > cooldownPoll/2 {
+			t.Errorf("%v: coolDown() waited %v with -maxwait=0", test.name, waited)
+		}
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	manifest := `{
+	"version": 1,
+	"languages": [
+		{"name": "C", "build": "cc C.c -o C", "run": "./C", "sources": ["C.c"], "artifact": "C"},
+
+		{
+			"name": "Racket",
+			"run": "racket Rkt.rkt",
+			"sources": ["Rkt.rkt"],
+			"tags": ["interpreted"]
+		}, {"name": "Go", "build": "go build -o Go Go.go", "run": "./Go", "sources": ["Go.go"], "env": {"GOGC": "off"}}
+	]
+}
+`
+	entries, err := parseManifest("m.json", []byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name+":"+strconv.Itoa(entry.line))
+	}
+	if want := []string{"C:4", "Racket:6", "Go:11"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed entries at %v, want %v", got, want)
+	}
+	if entries[2].Env["GOGC"] != "off" || entries[1].Build != "" {
+		t.Errorf("parsed %+v", entries)
+	}
+
+	for _, test := range []struct {
+		manifest string
+		want     string // Prefix of the error
+	}{
+		{"{\"version\": 1,\n\"languages\": [\n{\"name\": \"C\", \"compiler\": \"cc\"}]}", `m.json:3: unknown field "compiler"`},
+		{"{\"version\": 1,\n\"languages\": [\n{\"name\": \"C\",\n\"run\": 5}]}", "m.json:4: "},
+		{"{\"version\": 1,\n\"languages\": [\n{\n\"name\": \"C\", \"env\": {\"compiler\": \"cc\"},\n\"compiler\": \"cc\",\n\"run\": \"./C\"\n}]}", `m.json:5: unknown field "compiler"`},
+		{"{\"version\": 1,\n\n\"langs\": []}", "m.json:3: unknown field langs"},
+		{"{\"version\": 1,\n\"languages\": [\n{\"name\": \"C\"}\n", "m.json:4: "},
+		{"{\"version\": 2, \"languages\": []}", "m.json: manifest version 2 is newer"},
+	} {
+		_, err := parseManifest("m.json", []byte(test.manifest))
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("parsing %q failed with %v, want %q...", test.manifest, err, test.want)
+		}
+	}
+}
+
+func TestParseLegacyManifest(t *testing.T) {
+	c := "C\nclang C.c -O3\n./a.out\nC.c\na.out\n"
+	racket := "Racket\n-\nracket Rkt.rkt\nRkt.rkt\n-\n"
+	goLang := "Go\ngo build Go.go\n./Go\nGo.go\nGo\n"
+	for _, test := range []struct {
+		name, contents string
+		langs          int
+		want           string // Prefix of the error, if any
+	}{
+		{"good", c + racket + goLang, 3, ""},
+		{"trailing blank lines", c + racket + "\n\n", 2, ""},
+		{"compile command without arguments", "C\nmake\n./a.out\nC.c\na.out\n" + racket, 2, ""},
+		{"run command that looks like a file", "CSharp\nmcs Foo.cs\nfoo.exe\nFoo.cs\nfoo.exe\n" + racket + goLang, 3, ""},
+		{"no executable in the first", "C\nclang C.c -O3\n./a.out\nC.c\n" + racket, 0, `f.dat:1: language "C" is missing one of its five lines, as the next language seems to start at line 5`},
+		{"no source in the first", "C\nclang C.c -O3\n./a.out\na.out\n" + racket + goLang, 0, `f.dat:1: language "C" is missing one of its five lines`},
+		{"no run command in the middle", c + "Racket\n-\nRkt.rkt\n-\n" + goLang + "extra\n", 0, `f.dat:6: language "Racket" has "Rkt.rkt" as its run command`},
+		{"no compile command", "C\n./a.out\nC.c\na.out\n" + racket, 0, `f.dat:1: language "C" has "./a.out" as its compile command`},
+		{"extra line", c + "\n" + racket, 0, `f.dat:6: language "" has no name`},
+		{"short last language", c + "Go\ngo build Go.go\n./Go\n", 0, `f.dat:6: language "Go" has only 3 of its five lines`},
+	} {
+		entries, err := parseLegacyManifest("f.dat", []byte(test.contents))
+		switch {
+		case test.want == "" && (err != nil || len(entries) != test.langs):
+			t.Errorf("%v: parsed %v languages with error %v, want %v", test.name, len(entries), err, test.langs)
+		case test.want != "" && (err == nil || !strings.HasPrefix(err.Error(), test.want)):
+			t.Errorf("%v: failed with %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestSelectEntries(t *testing.T) {
+	entries := []ManifestEntry{
+		{Name: "C", Tags: []string{"compiled"}},
+		{Name: "Cpp", Tags: []string{"compiled"}},
+		{Name: "Java", Tags: []string{"compiled", "jvm"}},
+		{Name: "Clojure", Tags: []string{"interpreted", "jvm"}},
+		{Name: "Racket", Tags: []string{"interpreted"}},
+	}
+	for _, test := range []struct {
+		only, skip, tags []string
+		want             []string
+		ok               bool
+	}{
+		{nil, nil, nil, []string{"C", "Cpp", "Java", "Clojure", "Racket"}, true},
+		{[]string{"c*"}, nil, nil, []string{"C", "Cpp", "Clojure"}, true},
+		{[]string{"JAVA", "racket"}, nil, nil, []string{"Java", "Racket"}, true},
+		{[]string{"c*"}, []string{"cpp"}, nil, []string{"C", "Clojure"}, true},
+		{nil, nil, []string{"jvm"}, []string{"Java", "Clojure"}, true},
+		{nil, []string{"java"}, []string{"jvm", "interp*"}, []string{"Clojure", "Racket"}, true},
+		{[]string{"Nothing"}, nil, nil, nil, true},
+		{[]string{"["}, nil, nil, nil, false},
+	} {
+		selected, err := selectEntries(entries, test.only, test.skip, test.tags)
+		var got []string
+		for _, entry := range selected {
+			got = append(got, entry.Name)
+		}
+		if (err == nil) != test.ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("selectEntries(only %v, skip %v, tags %v) = %v, %v; want %v", test.only, test.skip, test.tags, got, err, test.want)
+		}
+	}
+}
+
+func TestParseRun(t *testing.T) {
+	legacy := "Average framerate was: 59.5 frames per second.\nAverage cpu time was- 0.0125 seconds per frame.\n" +
+		"The standard deviation was: 1.5 frames per second.\n--:60,59,0.5,.--\n"
+	renderTimes := "==:0.004,0.006,.==\n"
+	doc := func(version int) string {
+		return `{"schema":"particlebench.result","version":` + strconv.Itoa(version) + `,"metrics":{"fps":80,"fps_stddev":2,"cpu_time":0.01,"gpu_time":0.002},` +
+			`"frame_times":[0.02,0,0.0125],"gpu_times":[0.001,0.003],"run":{"implementation":"Go"},"environment":{"go_version":"go1.2"}}` + "\n"
+	}
+	for _, test := range []struct {
+		name, output, format  string
+		fps, cpuTime, gpuTime float64
+		frames, gpuTimes      []float64
+		env                   map[string]string
+	}{
+		{"legacy text", legacy, "text", 59.5, 0.0125, 0, []float64{60, 59, 0.5}, nil, nil},
+		{"legacy text with render times", legacy + renderTimes, "text", 59.5, 0.0125, 0.005, []float64{60, 59, 0.5}, []float64{0.004, 0.006}, nil},
+		{"result document", "Starting\n" + doc(1), "json", 80, 0.01, 0.002, []float64{50, 80}, []float64{0.001, 0.003}, map[string]string{"go_version": "go1.2"}},
+		{"result document preferred to text", legacy + renderTimes + doc(ResultVersion), "json", 80, 0.01, 0.002, []float64{50, 80}, []float64{0.001, 0.003}, map[string]string{"go_version": "go1.2"}},
+		{"newer result document", legacy + doc(ResultVersion+1), "text", 59.5, 0.0125, 0, []float64{60, 59, 0.5}, nil, nil},
+		{"another schema", legacy + `{"schema":"particlebench.other","version":1,"metrics":{"fps":1}}` + "\n", "text", 59.5, 0.0125, 0, []float64{60, 59, 0.5}, nil, nil},
+		{"broken result document", legacy + `{"schema":"particlebench.result","version":1,"metrics":` + "\n", "text", 59.5, 0.0125, 0, []float64{60, 59, 0.5}, nil, nil},
+		{"nothing", "Segmentation fault\n", "text", 0, 0, 0, nil, nil, nil},
+	} {
+		run := LangRun{Results: test.output}
+		parseRun("Test", &run)
+		if run.Format != test.format || !near(run.FPS, test.fps) || !near(run.CpuTime, test.cpuTime) || !near(run.GpuTime, test.gpuTime) ||
+			!nearAll(run.Frames, test.frames) || !nearAll(run.GpuTimes, test.gpuTimes) || !reflect.DeepEqual(run.Environment, test.env) {
+			t.Errorf("%v: parsed %v results: framerate %v, cpu time %v, render time %v, frames %v, render times %v, environment %v", test.name,
+				run.Format, run.FPS, run.CpuTime, run.GpuTime, run.Frames, run.GpuTimes, run.Environment)
+		}
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	pid := 0
+	start := time.Now()
+	out, _, err := runCommandUsage(time.Second, Placement{}, ".", "sleep 30 & sleep 30; echo done", func(p int) { pid = p })
+	if err != errTimeout || strings.Contains(out, "done") {
+		t.Fatalf("got %q, %v after %v; want a timeout", out, err, time.Since(start))
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Errorf("took %v to time out after 1s", waited)
+	}
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, stat := range stats {
+		contents, _ := os.ReadFile(stat)
+		fields := strings.Fields(string(contents[strings.LastIndexByte(string(contents), ')')+1:]))
+		if len(fields) > 2 && fields[2] == strconv.Itoa(pid) && fields[0] != "Z" { // Killed processes are zombies until they're reaped
+			t.Errorf("%s is still running after the timeout", contents)
+		}
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{nil, "ok"},
+		{errTimeout, "timeout"},
+		{errors.New("exit status 1"), "failed"},
+	} {
+		if got := outcome(test.err); got != test.want {
+			t.Errorf("outcome(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestDescribeTimeouts(t *testing.T) {
+	runs := func(outcomes ...string) []LangRun {
+		var runs []LangRun
+		for _, outcome := range outcomes {
+			runs = append(runs, LangRun{Outcome: outcome})
+		}
+		return runs
+	}
+	for _, test := range []struct {
+		lang Lang
+		want string
+	}{
+		{Lang{CmplOutcome: "ok", Runs: runs("ok", "ok")}, ""},
+		{Lang{CmplOutcome: "timeout"}, "timed out while compiling"},
+		{Lang{CmplOutcome: "ok", Runs: runs("ok", "timeout", "failed", "timeout")}, "timed out in 2 of 4 runs"},
+		{Lang{Interpreted: true, Runs: runs("timeout")}, "timed out in 1 of 1 runs"},
+	} {
+		if got := describeTimeouts(test.lang); got != test.want {
+			t.Errorf("describeTimeouts(%+v) = %q, want %q", test.lang, got, test.want)
+		}
+	}
+}
+
+func TestReadProcStat(t *testing.T) {
+	defer func(old string) { *procRoot = old }(*procRoot)
+	*procRoot = t.TempDir()
+	writeTree(t, *procRoot, map[string]string{
+		"10/stat": fakeStat(10, "java", 1, 10, 250, 30),
+		"11/stat": fakeStat(11, "my (odd) cmd", 10, 10, 5, 1),
+		"12/stat": "12 (short) S 1 12",
+		"13/stat": "13 java S 1 13 0 0 -1 0 0 0 0 0 1 1 0 0",
+	})
+	for _, test := range []struct {
+		pid  int
+		want procStat
+		ok   bool
+	}{
+		{10, procStat{Comm: "java", PPid: 1, PGrp: 10, UTime: 250, STime: 30}, true},
+		{11, procStat{Comm: "my (odd) cmd", PPid: 10, PGrp: 10, UTime: 5, STime: 1}, true},
+		{12, procStat{}, false},
+		{13, procStat{}, false},
+		{14, procStat{}, false},
+	} {
+		if got, ok := readProcStat(test.pid); got != test.want || ok != test.ok {
+			t.Errorf("readProcStat(%v) = %+v, %v; want %+v, %v", test.pid, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+// fakeTree is a run's process tree under a fake procfs: sh (100) started lein (101), whose second thread started java (102),
+// which started a helper (103). 104 was started by a process that has exited, but is still in the run's group; 105 is a new
+// process that took the pid of one from an earlier sample, and 300 is unrelated.
+func fakeTree(t *testing.T) {
+	t.Helper()
+	status := func(rss, hwm, threads string) string {
+		return "Name:\tx\nVmHWM:\t" + hwm + " kB\nVmRSS:\t" + rss + " kB\nThreads:\t" + threads + "\n"
+	}
+	*procRoot = t.TempDir()
+	writeTree(t, *procRoot, map[string]string{
+		"100/stat":              fakeStat(100, "sh", 50, 100, 1, 1),
+		"100/task/100/children": "101 ",
+		"100/status":            status("900", "90000", "1"),
+		"101/stat":              fakeStat(101, "lein", 100, 100, 100, 0),
+		"101/task/101/children": "",
+		"101/task/106/children": "102",
+		"101/status":            status("50000", "60000", "2"),
+		"102/stat":              fakeStat(102, "java", 101, 100, 500, 100),
+		"102/task/102/children": "103",
+		"102/status":            status("200000", "250000", "20"),
+		"103/stat":              fakeStat(103, "helper", 102, 100, 0, 0),
+		"103/task/103/children": "",
+		"103/status":            status("1000", "1000", "1"),
+		"104/stat":              fakeStat(104, "daemon", 1, 100, 10, 10),
+		"104/task/104/children": "",
+		"104/status":            status("3000", "3000", "1"),
+		"105/stat":              fakeStat(105, "other", 1, 105, 0, 0),
+		"105/task/105/children": "",
+		"105/status":            status("7", "7", "1"),
+		"300/stat":              fakeStat(300, "unrelated", 1, 300, 0, 0),
+		"300/task/300/children": "",
+		"300/status":            status("7", "7", "1"),
+	})
+}
+
+func TestProcessTree(t *testing.T) {
+	defer func(old string) { *procRoot = old }(*procRoot)
+	fakeTree(t)
+	for _, test := range []struct {
+		root  int
+		known []int
+		want  []int
+	}{
+		{100, nil, []int{100, 101, 102, 103}},
+		{100, []int{104, 105, 106, 300}, []int{100, 101, 102, 103, 104}},
+		{102, nil, []int{102, 103}},
+		{999, nil, nil},
+	} {
+		tree := processTree(test.root, test.known)
+		var got []int
+		for pid := range tree {
+			got = append(got, pid)
+		}
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("processTree(%v, %v) = %v, want %v", test.root, test.known, got, test.want)
+		}
+	}
+	if java := processTree(100, nil)[102]; java.Comm != "java" || java.UTime != 500 {
+		t.Errorf("processTree kept java's stat as %+v", java)
+	}
+}
+
+func TestTreeSampler(t *testing.T) {
+	defer func(old string) { *procRoot = old }(*procRoot)
+	fakeTree(t)
+	samples, tree := startTreeSampler(100, time.Hour).stop()
+	if len(samples) != 1 {
+		t.Fatalf("took %v samples, want 1", len(samples))
+	}
+	if s := samples[0]; s.RSS != 251900 || s.HWM != 250000 || s.Threads != 24 || s.Procs != 4 {
+		t.Errorf("sampled %+v", s)
+	}
+	if tree.Processes != 4 || !near(tree.CPUTime, 7.02) || tree.PeakRSS != 251900 || tree.Dominant().Comm != "java" {
+		t.Errorf("summed the tree up as %+v", tree)
+	}
+	if tree.LargestRSS != 250000 { // Not the launching shell's 90000 KiB, even were it bigger
+		t.Errorf("took the largest process's peak as %v KiB, want java's 250000", tree.LargestRSS)
+	}
+}
+
+// writeStore writes records to a store in a temporary directory, one session per entry of sessions, returning its path.
+// Each session sampled memory every memInterval seconds.
+func writeStore(t *testing.T, name string, memInterval float64, sessions ...[]StoredLang) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	var lines []string
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, langs := range sessions {
+		for _, lang := range langs {
+			line, err := json.Marshal(StoredResult{Schema: StoreSchema, Version: StoreVersion, Session: start.Add(time.Duration(i) * time.Hour),
+				Revision: "rev" + strconv.Itoa(i), MemInterval: memInterval, Lang: lang})
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, string(line))
+		}
+	}
+	writeTree(t, filepath.Dir(path), map[string]string{name: strings.Join(lines, "\n") + "\n"})
+	return path
+}
+
+func TestQueryResults(t *testing.T) {
+	c := func(fps float64) StoredLang { return StoredLang{Name: "C", Loaded: true, FPS: fps} }
+	java := func(fps float64) StoredLang { return StoredLang{Name: "Java", Loaded: true, FPS: fps} }
+	path := writeStore(t, "history.jsonl", 1, []StoredLang{c(1), java(1)}, []StoredLang{c(2)}, []StoredLang{c(3), java(3)}, []StoredLang{java(4)})
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("not json\n{\"schema\": \"particlebench.history\", \"version\": 99, \"lang\": {\"name\": \"C\"}}\n")
+	f.Close()
+	for _, test := range []struct {
+		name string
+		q    ResultQuery
+		want []string
+	}{
+		{"all", ResultQuery{}, []string{"C1", "Java1", "C2", "C3", "Java3", "Java4"}},
+		{"last session", ResultQuery{Last: 1}, []string{"Java4"}},
+		{"last two sessions", ResultQuery{Last: 2}, []string{"C3", "Java3", "Java4"}},
+		{"more sessions than there are", ResultQuery{Last: 10}, []string{"C1", "Java1", "C2", "C3", "Java3", "Java4"}},
+		{"last sessions of a language", ResultQuery{Langs: []string{"c"}, Last: 2}, []string{"C2", "C3"}},
+		{"glob", ResultQuery{Langs: []string{"J*"}}, []string{"Java1", "Java3", "Java4"}},
+		{"revision", ResultQuery{Revision: "rev2"}, []string{"C3", "Java3"}},
+		{"since and until", ResultQuery{Since: time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC), Until: time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)},
+			[]string{"C2", "C3", "Java3"}},
+	} {
+		found, err := queryResults(path, test.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, rec := range found {
+			got = append(got, rec.Lang.Name+strconv.Itoa(int(rec.Lang.FPS)))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: found %v, want %v", test.name, got, test.want)
+		}
+	}
+	if _, err := queryResults(filepath.Join(t.TempDir(), "missing.jsonl"), ResultQuery{}); err == nil {
+		t.Errorf("reading a missing store didn't fail")
+	}
+}
+
+func TestStoredLang(t *testing.T) {
+	lang := Lang{Name: "Go", Dir: "scratch/Go", Loaded: true, CmplOutcome: "ok", FPS: 60, PcntMaxFps: 80, MemUse: 5000,
+		Runs: []LangRun{{Repetition: 1, Cooldown: 1500 * time.Millisecond, Outcome: "ok", Results: "Average framerate was: 60 frames per second.", FPS: 60,
+			Tree: TreeUsage{Processes: 2, Procs: []ProcUsage{{Pid: 10, Comm: "Go"}}}}}}
+	line, err := json.Marshal(storedLang(lang))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"name", "loaded", "compile_outcome", "fps", "mem_use", "runs"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("stored %s without %v", line, key)
+		}
+	}
+	for _, left := range []string{"Dir", "PcntMaxFps", "Results", "Average framerate"} {
+		if strings.Contains(string(line), left) {
+			t.Errorf("stored %s with %v", line, left)
+		}
+	}
+	run := fields["runs"].([]interface{})[0].(map[string]interface{})
+	if run["cooldown"] != 1.5 || run["tree"].(map[string]interface{})["procs"].([]interface{})[0].(map[string]interface{})["comm"] != "Go" {
+		t.Errorf("stored the run as %v", run)
+	}
+}
+
+func TestCompareCommand(t *testing.T) {
+	lang := func(name string, fps, cpu float64, mem int64) StoredLang {
+		return StoredLang{Name: name, Loaded: true, FPS: fps, CpuTime: cpu, MemUse: mem, CmplTime: 2, CmplOutcome: "ok"}
+	}
+	uncompiled := lang("C", 60, 0.010, 1000) // As when run with -c=false
+	uncompiled.CmplTime, uncompiled.CmplOutcome = 0, ""
+	untimed := lang("C", 60, 0.010, 1000)
+	untimed.CmplTime = 0
+	baseline := writeStore(t, "baseline.jsonl", 1, []StoredLang{lang("C", 10, 1, 1000), lang("Go", 100, 0.01, 5000)}, // An older session, ignored
+		[]StoredLang{lang("C", 60, 0.010, 1000), lang("Go", 50, 0.020, 5000), {Name: "Racket"}})
+	for _, test := range []struct {
+		name        string
+		args        []string
+		memInterval float64
+		current     []StoredLang
+		want        int
+	}{
+		{"unchanged", nil, 1, []StoredLang{lang("C", 60, 0.010, 1000), lang("Go", 50, 0.020, 5000)}, 0},
+		{"within thresholds", nil, 1, []StoredLang{lang("C", 58, 0.0104, 1090), lang("Go", 51, 0.019, 4000)}, 0},
+		{"slower", nil, 1, []StoredLang{lang("C", 54, 0.010, 1000), lang("Go", 50, 0.020, 5000)}, 1},
+		{"slower, with a looser threshold", []string{"-fps", "0.2"}, 1, []StoredLang{lang("C", 54, 0.010, 1000), lang("Go", 50, 0.020, 5000)}, 0},
+		{"worse everywhere", nil, 1, []StoredLang{lang("C", 30, 0.020, 2000), lang("Go", 50, 0.020, 5000)}, 3},
+		{"metric no longer reported", nil, 1, []StoredLang{lang("C", 0, 0.010, 1000), lang("Go", 50, 0.020, 5000)}, 1},
+		{"unchecked metric no longer reported", []string{"-fps", "-1"}, 1, []StoredLang{lang("C", 0, 0.010, 1000), lang("Go", 50, 0.020, 5000)}, 0},
+		{"compile time not measured", nil, 1, []StoredLang{uncompiled, lang("Go", 50, 0.020, 5000)}, 0},
+		{"compile time missing", nil, 1, []StoredLang{untimed, lang("Go", 50, 0.020, 5000)}, 1},
+		{"memory not measured", nil, 0, []StoredLang{lang("C", 60, 0.010, 0), lang("Go", 50, 0.020, 0)}, 0},
+		{"memory missing", nil, 1, []StoredLang{lang("C", 60, 0.010, 0), lang("Go", 50, 0.020, 5000)}, 1},
+		{"language failed", nil, 1, []StoredLang{{Name: "C"}, lang("Go", 50, 0.020, 5000)}, 1},
+		{"language missing", nil, 1, []StoredLang{lang("C", 60, 0.010, 1000)}, 1},
+		{"language missing, but not compared", []string{"-lang", "C"}, 1, []StoredLang{lang("C", 60, 0.010, 1000)}, 0},
+		{"new language", nil, 1, []StoredLang{lang("C", 60, 0.010, 1000), lang("Go", 50, 0.020, 5000), lang("Rust", 70, 0.01, 900)}, 0},
+		{"baseline failure runs now", nil, 1, []StoredLang{lang("C", 60, 0.010, 1000), lang("Go", 50, 0.020, 5000), lang("Racket", 10, 0.1, 90000)}, 0},
+	} {
+		current := writeStore(t, "current.jsonl", test.memInterval, test.current)
+		got, err := compareCommand(append(test.args, baseline, current))
+		if err != nil || got != test.want {
+			t.Errorf("%v: found %v regressions with error %v, want %v", test.name, got, err, test.want)
+		}
+	}
+	if _, err := compareCommand([]string{filepath.Join(t.TempDir(), "missing.jsonl"), baseline}); err == nil {
+		t.Errorf("comparing against a missing baseline didn't fail")
+	}
+}
+
+// A run's peak memory mustn't include Benchmarker's own, which the launching shell's rusage inherits.
+func TestMemUseIgnoresBenchmarkerHeap(t *testing.T) {
+	if _, err := os.Stat("/proc/self/status"); err != nil {
+		t.Skip("needs procfs")
+	}
+	heap := make([]byte, 256<<20)
+	for i := 0; i < len(heap); i += 4096 { // Touch every page, so it's all resident
+		heap[i] = 1
+	}
+	var sampler *treeSampler
+	_, usage, err := runCommandUsage(time.Minute, Placement{}, ".", "sleep 1; true", func(pid int) {
+		sampler = startTreeSampler(pid, 50*time.Millisecond)
+	})
+	_, tree := sampler.stop()
+	runtime.KeepAlive(heap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.LargestRSS <= 0 || tree.LargestRSS > 64<<10 || tree.PeakRSS > 64<<10 {
+		t.Errorf("sleep's peak resident memory was %v KiB, and the tree's %v KiB, with a 256 MiB heap in Benchmarker", tree.LargestRSS, tree.PeakRSS)
+	}
+	if usage.UserTime+usage.SysTime > 1 {
+		t.Errorf("sleep used %v seconds of cpu time", usage.UserTime+usage.SysTime)
+	}
+}
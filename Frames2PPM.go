@@ -1,11 +1,12 @@
-/*	Opens FrameFile, outputs a bar graph representing their framerate over time. Horizontal axis is their framerate/MaxFramerate.
-	If relativeGraphs == true, horizontal axis is their framerate/(their maximum framerate).
+/*	Opens FrameFile (or the file given by -in), outputs a bar graph representing their framerate over time. Horizontal axis is their framerate/MaxFramerate (or -max).
+	If -relative is set, horizontal axis is their framerate/(their maximum framerate); use it for series other than framerates, such as render times.
 	Vertical axis is time.
 */
 
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"strconv"
@@ -18,7 +19,12 @@ const PixelHeight = 600
 const Fill = "255 255 255"
 const Empty = "0 0 0"
 const MaxFramerate = 100
-const relativeGraphs = false
+
+var (
+	inFile         = flag.String("in", FrameFile, "File of comma-separated values to graph")
+	maxVal         = flag.Float64("max", MaxFramerate, "Value drawn as a full-width bar")
+	relativeGraphs = flag.Bool("relative", false, "Scale bars to the largest value instead of -max")
+)
 
 type Row struct {
 	Val           float64
@@ -38,7 +44,8 @@ func decRes(arr []string) []string {
 }
 
 func main() {
-	frames, err := ioutil.ReadFile(FrameFile)
+	flag.Parse()
+	frames, err := ioutil.ReadFile(*inFile)
 	if err != nil {
 		panic(err)
 	}
@@ -62,8 +69,8 @@ func main() {
 			max = float
 		}
 	}
-	if relativeGraphs == false {
-		max = MaxFramerate
+	if *relativeGraphs == false {
+		max = *maxVal
 	}
 	rows := make([]Row, 0, len(floatData))
 	for _, float := range floatData {
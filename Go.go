@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	gl "github.com/chsc/gogl/gl21"
 	glfw "github.com/go-gl/glfw3"
@@ -35,6 +37,10 @@ const (
 	MinDepth = 50
 	MaxDepth = 250
 
+	ViewNear = 1    // Distance to the near clipping plane of the viewing frustum
+	ViewFar  = 1000 // Distance to the far clipping plane
+	ViewTilt = 20   // Degrees the view is rotated around the X axis
+
 	WindChange    = 2000                 // The maximum change in windspeed per second, in milliseconds
 	MaxWind       = 3                    // Maximum windspeed in seconds before wind is reversed at half speed
 	SpawnInterval = 0.01                 // How often particles are spawned, in seconds
@@ -60,9 +66,9 @@ var (
 	cleanupTmr float64   // Timer for cleaning up the particle array
 	runTmr     float64   // Timer of total running timer
 
-	frames   [RunningTime * 1000]float64   // Array for storing the length of each frame
-	gpuTimes   [RunningTime * 1000]float64 // Array for storing the cpu time spent before swapping buffers for each frame
-	curFrame uint64                        // The current number of frames that have elapsed
+	frames   = make([]float64, 0, RunningTime*1000) // Slice for storing the length of each frame; room for 1000fps, which the null renderer can exceed
+	gpuTimes = make([]float64, 0, RunningTime*1000) // Slice for storing the cpu time spent before swapping buffers for each frame
+	curFrame uint64                                 // The current number of frames that have elapsed
 
 	windX float64 = 0 // Windspeed
 	windY float64 = 0
@@ -200,58 +206,77 @@ func doWind() {
 }
 
 func main() {
+	flag.Parse()
 	f, err := os.Create("Go.pprof") // Create file for profiling
 	if err != nil {
 		panic(err)
 	}
 
-	glfw.SetErrorCallback(errorCallback)
-	if !glfw.Init() {
-		panic("Can't init glfw!")
-	}
-	defer glfw.Terminate()
-	glfw.WindowHint(glfw.Samples, 2)
-	glfw.WindowHint(glfw.ContextVersionMajor, 2)
-	glfw.WindowHint(glfw.ContextVersionMinor, 1)
-	window, err := glfw.CreateWindow(Width, Height, Title, nil, nil)
+	r, err := newRenderer(*renderer)
 	if err != nil {
 		panic(err)
 	}
-	window.MakeContextCurrent()
-
-	glfw.SwapInterval(0) // No limit on FPS
-	gl.Init()
-	initScene()
-	loadCubeToGPU()
-	for !window.ShouldClose() {
+	if err = r.Init(); err != nil {
+		panic(err)
+	}
+	defer r.Close()
+	r.Upload()
+	var frameWriter *pngWriter
+	var frameSrc frameReader
+	if *pngDir != "" {
+		var ok bool
+		if frameSrc, ok = r.(frameReader); !ok {
+			panic("Saving frames needs a CPU-side renderer, such as -renderer=soft")
+		}
+		frameWriter, err = newPNGWriter(*pngDir, *pngEvery, *pngSize)
+		if err != nil {
+			panic(err)
+		}
+	}
+	var tel *telemetry // Stays nil, doing nothing, unless a telemetry stream was asked for
+	if *telemetryPath != "" {
+		if tel, err = newTelemetry(*telemetryPath); err != nil {
+			panic(err)
+		}
+		defer tel.close()
+	}
+	for open := true; open; {
 		frameInitT = time.Now()
+		tel.begin(frameInitT)
 		movPts(frameDur)
+		tel.mark(phaseMove)
 		doWind()
+		tel.mark(phaseWind)
 		if spwnTmr >= SpawnInterval {
 			spwnPts(SpawnInterval)
 			spwnTmr -= SpawnInterval
 		}
+		tel.mark(phaseSpawn)
 		if cleanupTmr >= float64(MaxLife)/1000 {
 			cleanupPtPool()
 			cleanupTmr = 0
 		}
+		tel.mark(phaseCleanup)
 		checkColls()
-		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
-		
+		tel.mark(phaseCollide)
+
 		gpuInitT = time.Now()
-		renderPts()		
-		window.SwapBuffers()
+		r.DrawParticles()
+		open = r.Present()
 		gpuEndT = time.Now()
-		glfw.PollEvents()
 
 		frameEndT = time.Now()
 		frameDur = frameEndT.Sub(frameInitT).Seconds() // Calculate the length of the previous frame
 		spwnTmr += frameDur
 		cleanupTmr += frameDur
 		runTmr += frameDur
+		tel.send(frameDur, gpuEndT.Sub(gpuInitT).Seconds())
+		if frameWriter != nil { // Saved after the frame's timing is taken, so the encoding isn't counted
+			frameWriter.capture(frameSrc.Frame())
+		}
 		if runTmr > MaxLife/1000 { // Start collecting framerate data and profiling after a full MaxLife worth of particles have been spawned
-			frames[curFrame] = frameDur
-			gpuTimes[curFrame] = gpuEndT.Sub(gpuInitT).Seconds()
+			frames = append(frames, frameDur)
+			gpuTimes = append(gpuTimes, gpuEndT.Sub(gpuInitT).Seconds())
 			curFrame += 1
 			pprof.StartCPUProfile(f)			
 		}
@@ -263,14 +288,12 @@ func main() {
 				sum += frames[i]
 			}
 			frameTimeMean := sum / float64(curFrame)
-			fmt.Println("Average framerate was:", 1/frameTimeMean, "frames per second.")
 
 			sum = 0
 			for i = 0; i < curFrame; i++ {
 				sum += gpuTimes[i]
 			}
 			gpuTimeMean := sum / float64(curFrame)
-			fmt.Println("Average cpu time was-", frameTimeMean - gpuTimeMean, "seconds per frame.")
 
 			sumDiffs := 0.0
 			for i = 0; i < curFrame; i++ {
@@ -278,6 +301,12 @@ func main() {
 			}
 			variance := sumDiffs / float64(curFrame)
 			sd := math.Sqrt(variance)
+			if *jsonResult {
+				printResult(1/frameTimeMean, sd, frameTimeMean-gpuTimeMean, gpuTimeMean)
+				break
+			}
+			fmt.Println("Average framerate was:", 1/frameTimeMean, "frames per second.")
+			fmt.Println("Average cpu time was-", frameTimeMean - gpuTimeMean, "seconds per frame.")
 			fmt.Println("The standard deviation was:", sd, "frames per second.")
 			if PrintFrames == true{
 				fmt.Print("--:")
@@ -286,13 +315,76 @@ func main() {
 					fmt.Print(",")
 				}
 				fmt.Print(".--")
+				fmt.Print("==:") // Seconds spent rendering and swapping buffers in each frame
+				for i = 0; i < curFrame; i++ {
+					fmt.Print(gpuTimes[i])
+					fmt.Print(",")
+				}
+				fmt.Print(".==")
 			}		
 			break
 		}
 
 	}
+}
+
+func openWindow(major, minor int, core bool) (*glfw.Window, error) { // Opens a window with a current GL context of the given version
+	glfw.SetErrorCallback(errorCallback)
+	if !glfw.Init() {
+		return nil, errors.New("Can't init glfw!")
+	}
+	glfw.WindowHint(glfw.Samples, 2)
+	glfw.WindowHint(glfw.ContextVersionMajor, major)
+	glfw.WindowHint(glfw.ContextVersionMinor, minor)
+	if core {
+		glfw.WindowHint(glfw.OpenglProfile, glfw.OpenglCoreProfile)
+		glfw.WindowHint(glfw.OpenglForwardCompatible, glfw.True)
+	}
+	window, err := glfw.CreateWindow(Width, Height, Title, nil, nil)
+	if err != nil {
+		glfw.Terminate()
+		return nil, err
+	}
+	window.MakeContextCurrent()
+
+	glfw.SwapInterval(0) // No limit on FPS
+	return window, nil
+}
+
+type glRenderer struct { // Draws each particle with fixed-function GL 2.1, the same way every other implementation does
+	window *glfw.Window
+}
+
+func (r *glRenderer) Init() error {
+	window, err := openWindow(2, 1, false)
+	if err != nil {
+		return err
+	}
+	gl.Init()
+	initScene()
+	r.window = window
+	return nil
+}
+
+func (r *glRenderer) Upload() {
+	loadCubeToGPU()
+}
+
+func (r *glRenderer) DrawParticles() {
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	renderPts()
+}
+
+func (r *glRenderer) Present() bool {
+	r.window.SwapBuffers()
+	glfw.PollEvents()
+	return !r.window.ShouldClose()
+}
+
+func (r *glRenderer) Close() {
 	gl.DisableClientState(gl.NORMAL_ARRAY)
 	gl.DisableClientState(gl.VERTEX_ARRAY)
+	glfw.Terminate()
 }
 
 func initScene() {
@@ -311,8 +403,8 @@ func initScene() {
 	gl.Viewport(0, 0, Width, Height)
 	gl.MatrixMode(gl.PROJECTION)
 	gl.LoadIdentity()
-	gl.Frustum(-1, 1, -1, 1, 1.0, 1000.0)
-	gl.Rotatef(20, 1, 0, 0)
+	gl.Frustum(-1, 1, -1, 1, ViewNear, ViewFar)
+	gl.Rotatef(ViewTilt, 1, 0, 0)
 	gl.MatrixMode(gl.MODELVIEW)
 	gl.LoadIdentity()
 	gl.PushMatrix()
@@ -320,7 +412,7 @@ func initScene() {
 	return
 }
 
-func loadCubeToGPU() {
+func buildCube() { // Fill Vertices with the 24 vertices (six quads) of a unit cube
 	newNormal(0, 0, 1)
 	newVertex(-1, -1, 1)
 	newVertex(1, -1, 1)
@@ -356,7 +448,10 @@ func loadCubeToGPU() {
 	newVertex(-1, -1, 1)
 	newVertex(-1, 1, 1)
 	newVertex(-1, 1, -1)
+}
 
+func loadCubeToGPU() {
+	buildCube()
 	gl.GenBuffers(1, &gVBO)
 	gl.BindBuffer(gl.ARRAY_BUFFER, gVBO)
 	gl.BufferData(gl.ARRAY_BUFFER, gl.Sizeiptr(unsafe.Sizeof(Vertex{})*24), gl.Pointer(&Vertices[0]), gl.STATIC_DRAW)
@@ -0,0 +1,329 @@
+/*	GL 3.3 core renderers that draw every particle with a single draw call.
+	Each frame the live particles' translation and scale are copied into one buffer, replacing renderPts' per-particle
+	matrix calls and DrawArrays. Each particle is drawn as one of:
+	instanced: the lit cube, lit per vertex as the fixed-function path does, so frames should match the gl renderer's.
+	points: a point sprite, one vertex per particle, sized in the vertex shader and shaded as a sphere.
+	billboards: an instanced quad turned to face the camera, shaded like the point sprite.
+	The sprites cut the geometry to almost nothing, leaving mostly the cost of uploading the particles.
+*/
+
+package main
+
+import (
+	"fmt"
+	gl33 "github.com/chsc/gogl/gl33"
+	glfw "github.com/go-gl/glfw3"
+	"unsafe"
+)
+
+const cubeVertexShader = `#version 330 core
+layout(location = 0) in vec3 pos;
+layout(location = 1) in vec3 normal;
+layout(location = 2) in vec4 inst; // Translation in xyz, scale in w
+
+uniform mat4 proj;
+uniform mat4 view;
+uniform vec3 lightDir;
+uniform vec3 ambient;
+uniform vec3 diffuse;
+
+flat out vec4 colour;
+
+void main() {
+	gl_Position = proj * view * vec4(inst.xyz + pos*inst.w, 1.0);
+	float d = max(dot(normal/inst.w, lightDir), 0.0); // Unnormalised, as GL_NORMALIZE is off in the gl renderer
+	colour = vec4(min(ambient + diffuse*d, 1.0), 1.0);
+}
+`
+
+const flatFragmentShader = `#version 330 core
+flat in vec4 colour;
+out vec4 fragColour;
+
+void main() {
+	fragColour = colour;
+}
+`
+
+const pointVertexShader = `#version 330 core
+layout(location = 2) in vec4 inst;
+
+uniform mat4 proj;
+uniform mat4 view;
+uniform float pointScale; // Pixels per unit at a distance of one
+
+void main() {
+	gl_Position = proj * view * vec4(inst.xyz, 1.0);
+	gl_PointSize = 2.0*inst.w*pointScale/gl_Position.w;
+}
+`
+
+const billboardVertexShader = `#version 330 core
+layout(location = 0) in vec2 corner;
+layout(location = 2) in vec4 inst;
+
+uniform mat4 proj;
+uniform mat4 view;
+
+out vec2 spriteCoord;
+
+void main() {
+	vec4 centre = view * vec4(inst.xyz, 1.0);
+	gl_Position = proj * (centre + vec4(corner*inst.w, 0.0, 0.0)); // Offset after the view rotation, so it faces the camera
+	spriteCoord = corner;
+}
+`
+
+const spriteShading = `
+uniform vec3 lightDir;
+uniform vec3 ambient;
+uniform vec3 diffuse;
+
+out vec4 fragColour;
+
+void shade(vec2 c) { // Light the sprite as a sphere; c runs from -1 to 1 across it
+	float r2 = dot(c, c);
+	if (r2 > 1.0) {
+		discard;
+	}
+	vec3 n = vec3(c, sqrt(1.0 - r2));
+	fragColour = vec4(min(ambient + diffuse*max(dot(n, lightDir), 0.0), 1.0), 1.0);
+}
+`
+
+const pointFragmentShader = "#version 330 core\n" + spriteShading + `
+void main() {
+	shade(vec2(gl_PointCoord.x*2.0 - 1.0, 1.0 - gl_PointCoord.y*2.0));
+}
+`
+
+const billboardFragmentShader = "#version 330 core\n" + spriteShading + `
+in vec2 spriteCoord;
+
+void main() {
+	shade(spriteCoord);
+}
+`
+
+type particleShape int
+
+const (
+	shapeCube particleShape = iota
+	shapePoint
+	shapeBillboard
+)
+
+type gl33Renderer struct {
+	shape     particleShape
+	window    *glfw.Window
+	program   gl33.Uint
+	vao       gl33.Uint
+	shapeVBO  gl33.Uint    // The cube or billboard quad; unused for point sprites
+	instVBO   gl33.Uint    // Per-particle data
+	instances []gl33.Float // Translation and scale of each live particle, four floats apiece
+}
+
+func (r *gl33Renderer) Init() error {
+	window, err := openWindow(3, 3, true)
+	if err != nil {
+		return err
+	}
+	r.window = window
+	if err = gl33.Init(); err != nil {
+		return err
+	}
+	switch r.shape {
+	case shapeCube:
+		r.program, err = linkProgram(cubeVertexShader, flatFragmentShader)
+	case shapePoint:
+		r.program, err = linkProgram(pointVertexShader, pointFragmentShader)
+		gl33.Enable(gl33.PROGRAM_POINT_SIZE)
+	case shapeBillboard:
+		r.program, err = linkProgram(billboardVertexShader, billboardFragmentShader)
+	}
+	if err != nil {
+		return err
+	}
+	gl33.UseProgram(r.program)
+	setSceneUniforms(r.program)
+
+	gl33.Enable(gl33.DEPTH_TEST)
+	gl33.ClearColor(0.1, 0.1, 0.6, 1.0)
+	gl33.ClearDepth(1)
+	gl33.DepthFunc(gl33.LEQUAL)
+	gl33.Viewport(0, 0, Width, Height)
+	r.instances = make([]gl33.Float, 0, MaxPts*4)
+	return nil
+}
+
+func (r *gl33Renderer) Upload() {
+	gl33.GenVertexArrays(1, &r.vao)
+	gl33.BindVertexArray(r.vao)
+	switch r.shape {
+	case shapeCube:
+		buildCube()
+		var tris [36]Vertex // Core profile has no GL_QUADS, so split each face into two triangles
+		for face := 0; face < 6; face++ {
+			q := Vertices[face*4 : face*4+4]
+			copy(tris[face*6:], []Vertex{q[0], q[1], q[2], q[0], q[2], q[3]})
+		}
+		gl33.GenBuffers(1, &r.shapeVBO)
+		gl33.BindBuffer(gl33.ARRAY_BUFFER, r.shapeVBO)
+		gl33.BufferData(gl33.ARRAY_BUFFER, gl33.Sizeiptr(unsafe.Sizeof(tris)), gl33.Pointer(&tris[0]), gl33.STATIC_DRAW)
+		tmpStruct := Vertex{}
+		gl33.EnableVertexAttribArray(0)
+		gl33.VertexAttribPointer(0, 3, gl33.FLOAT, gl33.FALSE, gl33.Sizei(unsafe.Sizeof(tmpStruct)), nil)
+		gl33.EnableVertexAttribArray(1)
+		gl33.VertexAttribPointer(1, 3, gl33.FLOAT, gl33.FALSE, gl33.Sizei(unsafe.Sizeof(tmpStruct)), gl33.Pointer(unsafe.Offsetof(tmpStruct.normal)))
+	case shapeBillboard:
+		quad := [8]gl33.Float{-1, -1, 1, -1, -1, 1, 1, 1} // A triangle strip
+		gl33.GenBuffers(1, &r.shapeVBO)
+		gl33.BindBuffer(gl33.ARRAY_BUFFER, r.shapeVBO)
+		gl33.BufferData(gl33.ARRAY_BUFFER, gl33.Sizeiptr(unsafe.Sizeof(quad)), gl33.Pointer(&quad[0]), gl33.STATIC_DRAW)
+		gl33.EnableVertexAttribArray(0)
+		gl33.VertexAttribPointer(0, 2, gl33.FLOAT, gl33.FALSE, 0, nil)
+	}
+
+	gl33.GenBuffers(1, &r.instVBO)
+	gl33.BindBuffer(gl33.ARRAY_BUFFER, r.instVBO)
+	gl33.EnableVertexAttribArray(2)
+	gl33.VertexAttribPointer(2, 4, gl33.FLOAT, gl33.FALSE, 0, nil)
+	if r.shape != shapePoint {
+		gl33.VertexAttribDivisor(2, 1) // One translation and scale per cube or quad, not per vertex
+	}
+}
+
+func (r *gl33Renderer) DrawParticles() {
+	gl33.Clear(gl33.COLOR_BUFFER_BIT | gl33.DEPTH_BUFFER_BIT)
+	n := gl33.Sizei(r.uploadInstances())
+	if n == 0 {
+		return
+	}
+	switch r.shape {
+	case shapeCube:
+		gl33.DrawArraysInstanced(gl33.TRIANGLES, 0, 36, n)
+	case shapePoint:
+		gl33.DrawArrays(gl33.POINTS, 0, n)
+	case shapeBillboard:
+		gl33.DrawArraysInstanced(gl33.TRIANGLE_STRIP, 0, 4, n)
+	}
+}
+
+// uploadInstances copies the live particles into the instance buffer and returns how many there are.
+func (r *gl33Renderer) uploadInstances() int {
+	inst := r.instances[:0]
+	for i := minPt; i <= maxPt; i++ {
+		if Pts[i].is == false {
+			continue
+		}
+		pt := &Pts[i]
+		inst = append(inst, gl33.Float(pt.X), gl33.Float(pt.Y), -gl33.Float(pt.Z), gl33.Float(pt.R*2))
+	}
+	r.instances = inst
+	if len(inst) == 0 {
+		return 0
+	}
+	gl33.BindBuffer(gl33.ARRAY_BUFFER, r.instVBO)
+	gl33.BufferData(gl33.ARRAY_BUFFER, gl33.Sizeiptr(len(inst)*4), gl33.Pointer(&inst[0]), gl33.STREAM_DRAW)
+	return len(inst) / 4
+}
+
+func (r *gl33Renderer) Present() bool {
+	r.window.SwapBuffers()
+	glfw.PollEvents()
+	return !r.window.ShouldClose()
+}
+
+func (r *gl33Renderer) Close() {
+	if r.program != 0 {
+		gl33.DeleteBuffers(1, &r.instVBO)
+		gl33.DeleteBuffers(1, &r.shapeVBO)
+		gl33.DeleteVertexArrays(1, &r.vao)
+		gl33.DeleteProgram(r.program)
+	}
+	glfw.Terminate()
+}
+
+// setSceneUniforms gives a program the projection and lighting initScene sets up for the fixed-function path.
+func setSceneUniforms(program gl33.Uint) {
+	uniform := func(name string) gl33.Int {
+		cName := gl33.GLString(name)
+		defer gl33.GLStringFree(cName)
+		return gl33.GetUniformLocation(program, cName)
+	}
+	var m [16]gl33.Float
+	proj := frustum(-1, 1, -1, 1, ViewNear, ViewFar)
+	for i, v := range proj {
+		m[i] = gl33.Float(v)
+	}
+	gl33.UniformMatrix4fv(uniform("proj"), 1, gl33.FALSE, &m[0])
+	for i, v := range rotateX(ViewTilt) {
+		m[i] = gl33.Float(v)
+	}
+	gl33.UniformMatrix4fv(uniform("view"), 1, gl33.FALSE, &m[0])
+
+	l := lightDirection()
+	gl33.Uniform3f(uniform("lightDir"), gl33.Float(l[0]), gl33.Float(l[1]), gl33.Float(l[2]))
+	var amb, dif [3]gl33.Float
+	for i := range amb {
+		amb[i] = gl33.Float(modelAmbient*matAmbient + float64(ambient[i])*matAmbient)
+		dif[i] = gl33.Float(float64(diffuse[i]) * matDiffuse)
+	}
+	gl33.Uniform3f(uniform("ambient"), amb[0], amb[1], amb[2])
+	gl33.Uniform3f(uniform("diffuse"), dif[0], dif[1], dif[2])
+	gl33.Uniform1f(uniform("pointScale"), gl33.Float(proj[5]*Height/2)) // Uniforms a shader doesn't use are ignored
+}
+
+func linkProgram(vertexSrc, fragmentSrc string) (gl33.Uint, error) {
+	vs, err := compileShader(gl33.VERTEX_SHADER, vertexSrc)
+	if err != nil {
+		return 0, err
+	}
+	defer gl33.DeleteShader(vs)
+	fs, err := compileShader(gl33.FRAGMENT_SHADER, fragmentSrc)
+	if err != nil {
+		return 0, err
+	}
+	defer gl33.DeleteShader(fs)
+	program := gl33.CreateProgram()
+	gl33.AttachShader(program, vs)
+	gl33.AttachShader(program, fs)
+	gl33.LinkProgram(program)
+	var status, logLen gl33.Int
+	gl33.GetProgramiv(program, gl33.LINK_STATUS, &status)
+	if status == gl33.FALSE {
+		gl33.GetProgramiv(program, gl33.INFO_LOG_LENGTH, &logLen)
+		log := make([]byte, logLen+1)
+		gl33.GetProgramInfoLog(program, gl33.Sizei(len(log)), nil, (*gl33.Char)(unsafe.Pointer(&log[0])))
+		gl33.DeleteProgram(program)
+		return 0, fmt.Errorf("linking shaders failed: %s", cString(log))
+	}
+	return program, nil
+}
+
+func compileShader(kind gl33.Enum, src string) (gl33.Uint, error) {
+	shader := gl33.CreateShader(kind)
+	cSrc := gl33.GLString(src)
+	defer gl33.GLStringFree(cSrc)
+	gl33.ShaderSource(shader, 1, &cSrc, nil)
+	gl33.CompileShader(shader)
+	var status, logLen gl33.Int
+	gl33.GetShaderiv(shader, gl33.COMPILE_STATUS, &status)
+	if status == gl33.FALSE {
+		gl33.GetShaderiv(shader, gl33.INFO_LOG_LENGTH, &logLen)
+		log := make([]byte, logLen+1)
+		gl33.GetShaderInfoLog(shader, gl33.Sizei(len(log)), nil, (*gl33.Char)(unsafe.Pointer(&log[0])))
+		gl33.DeleteShader(shader)
+		return 0, fmt.Errorf("compiling shader failed: %s", cString(log))
+	}
+	return shader, nil
+}
+
+func cString(b []byte) string { // The Go string held in a NUL-terminated buffer
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
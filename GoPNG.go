@@ -0,0 +1,88 @@
+/*	Writes every Nth frame drawn by a CPU-side renderer to numbered PNG files, so runs on headless machines can be inspected.
+	Frames are encoded outside the timed part of the frame, but the disk traffic will still disturb the results,
+	so don't compare framerates from runs that saved frames.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+var (
+	pngDir   = flag.String("png", "", "Directory to save rendered frames to as PNG files; needs a CPU-side renderer such as -renderer=soft")
+	pngEvery = flag.Int("pngevery", 30, "Save every Nth rendered frame")
+	pngSize  = flag.String("pngsize", "", "Resolution of the saved frames as WIDTHxHEIGHT, if not the framebuffer's")
+)
+
+type pngWriter struct {
+	dir    string
+	every  int
+	width  int // Zero to keep the framebuffer's size
+	height int
+	frame  int // Number of frames seen so far
+	scaled *image.RGBA
+}
+
+func newPNGWriter(dir string, every int, size string) (*pngWriter, error) {
+	if every < 1 {
+		return nil, fmt.Errorf("frame interval must be at least 1, not %v", every)
+	}
+	w := &pngWriter{dir: dir, every: every}
+	if size != "" {
+		if _, err := fmt.Sscanf(size, "%dx%d", &w.width, &w.height); err != nil || w.width < 1 || w.height < 1 {
+			return nil, fmt.Errorf("invalid frame size %q, expected WIDTHxHEIGHT", size)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// capture is called with every rendered frame and saves those that fall on the interval.
+func (w *pngWriter) capture(img *image.RGBA) {
+	frame := w.frame
+	w.frame++
+	if frame%w.every != 0 {
+		return
+	}
+	out := img
+	if w.width != 0 && (w.width != img.Rect.Dx() || w.height != img.Rect.Dy()) {
+		out = w.resize(img)
+	}
+	name := filepath.Join(w.dir, fmt.Sprintf("frame_%06d.png", frame))
+	f, err := os.Create(name)
+	if err != nil {
+		fmt.Printf("Failed to create frame file %v, failing with error %v\n", name, err)
+		return
+	}
+	err = png.Encode(f, out)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		fmt.Printf("Failed to write frame file %v, failing with error %v\n", name, err)
+	}
+}
+
+func (w *pngWriter) resize(img *image.RGBA) *image.RGBA { // Nearest-neighbour scaling, which is plenty for eyeballing a run
+	if w.scaled == nil {
+		w.scaled = image.NewRGBA(image.Rect(0, 0, w.width, w.height))
+	}
+	srcW, srcH := img.Rect.Dx(), img.Rect.Dy()
+	for y := 0; y < w.height; y++ {
+		src := img.Pix[(y*srcH/w.height)*img.Stride:]
+		dst := w.scaled.Pix[y*w.scaled.Stride:]
+		for x := 0; x < w.width; x++ {
+			sx := x * srcW / w.width * 4
+			copy(dst[x*4:x*4+4], src[sx:sx+4])
+		}
+	}
+	return w.scaled
+}
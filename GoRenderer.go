@@ -0,0 +1,62 @@
+/*	The Renderer interface lets the benchmark compare ways of drawing the particles without forking Go.go.
+	The backend is chosen with -renderer; gl, the fixed-function path in Go.go, is what every other language implements
+	and the only one whose results should be compared across languages.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+)
+
+type Renderer interface {
+	Init() error    // Opens the drawing surface and sets up the scene
+	Upload()        // Loads the cube geometry
+	DrawParticles() // Clears the frame and draws every live particle in Pts
+	Present() bool  // Shows the finished frame, returning false once the user has closed the window
+	Close()         // Releases whatever Init acquired
+}
+
+type frameReader interface { // Implemented by renderers that draw into memory, whose frames can be saved
+	Frame() *image.RGBA
+}
+
+var renderers = map[string]func() Renderer{
+	"gl":         func() Renderer { return &glRenderer{} },
+	"instanced":  func() Renderer { return &gl33Renderer{shape: shapeCube} },
+	"points":     func() Renderer { return &gl33Renderer{shape: shapePoint} },
+	"billboards": func() Renderer { return &gl33Renderer{shape: shapeBillboard} },
+	"null":       func() Renderer { return nullRenderer{} },
+	"soft":       func() Renderer { return newSoftRenderer(Width, Height) },
+}
+
+var renderer = flag.String("renderer", "gl", "How to draw the particles: "+strings.Join(rendererNames(), ", "))
+
+func rendererNames() []string {
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newRenderer(name string) (Renderer, error) {
+	newR, ok := renderers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown renderer %q, expected one of %v", name, strings.Join(rendererNames(), ", "))
+	}
+	return newR(), nil
+}
+
+type nullRenderer struct{} // Draws nothing, so the framerate measures the simulation alone
+
+func (nullRenderer) Init() error    { return nil }
+func (nullRenderer) Upload()        {}
+func (nullRenderer) DrawParticles() {}
+func (nullRenderer) Present() bool  { return true }
+func (nullRenderer) Close()         {}
@@ -0,0 +1,98 @@
+/*	The versioned JSON result document, printed instead of the legacy text when -json is given.
+	Benchmarker.go prefers it to scraping the text, since the text changes whenever an implementation's wording or float format does.
+	Bump ResultVersion whenever a field changes meaning or is removed; adding fields doesn't need a new version.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+const (
+	ResultSchema  = "particlebench.result"
+	ResultVersion = 1
+)
+
+var jsonResult = flag.Bool("json", false, "Print the results as a single-line JSON document instead of the legacy text")
+
+type Result struct {
+	Schema     string        `json:"schema"`
+	Version    int           `json:"version"`
+	Metrics    ResultMetrics `json:"metrics"`
+	FrameTimes []float64     `json:"frame_times"` // Seconds taken by each measured frame
+	GpuTimes   []float64     `json:"gpu_times"`   // Seconds of each measured frame spent rendering and swapping buffers
+	Run        ResultRun     `json:"run"`
+	// Where the implementation ran, as free-form name/value pairs so every language can report what matters for it
+	Environment map[string]string `json:"environment"`
+}
+
+type ResultMetrics struct {
+	FPS       float64 `json:"fps"`        // Mean framerate
+	FPSStdDev float64 `json:"fps_stddev"` // Standard deviation of the per-frame framerate
+	CpuTime   float64 `json:"cpu_time"`   // Mean seconds per frame spent outside rendering and swapping buffers
+	GpuTime   float64 `json:"gpu_time"`   // Mean seconds per frame spent rendering and swapping buffers
+}
+
+type ResultRun struct {
+	Implementation string    `json:"implementation"`
+	Renderer       string    `json:"renderer"`
+	Width          int       `json:"width"`
+	Height         int       `json:"height"`
+	RunningTime    float64   `json:"running_time"`    // Seconds the animation ran for, including the unmeasured warm-up
+	WarmUpTime     float64   `json:"warm_up_time"`    // Seconds before frames were measured
+	MeasuredFrames int       `json:"measured_frames"` // Length of FrameTimes
+	Finished       time.Time `json:"finished"`
+}
+
+func printResult(fps, fpsStdDev, cpuTime, gpuTime float64) {
+	res := Result{
+		Schema:     ResultSchema,
+		Version:    ResultVersion,
+		Metrics:    ResultMetrics{FPS: fps, FPSStdDev: fpsStdDev, CpuTime: cpuTime, GpuTime: gpuTime},
+		FrameTimes: frames,
+		GpuTimes:   gpuTimes,
+		Run: ResultRun{
+			Implementation: "Go",
+			Renderer:       *renderer,
+			Width:          Width,
+			Height:         Height,
+			RunningTime:    runTmr,
+			WarmUpTime:     MaxLife / 1000,
+			MeasuredFrames: len(frames),
+			Finished:       time.Now().UTC(),
+		},
+		Environment: environment(),
+	}
+	doc, err := json.Marshal(res)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(doc))
+}
+
+func environment() map[string]string {
+	env := map[string]string{
+		"go_version": runtime.Version(),
+		"goos":       runtime.GOOS,
+		"goarch":     runtime.GOARCH,
+		"gomaxprocs": strconv.Itoa(runtime.GOMAXPROCS(0)),
+		"num_cpu":    strconv.Itoa(runtime.NumCPU()),
+		"compiler":   runtime.Compiler,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings { // -gcflags, -ldflags, -tags, CGO_ENABLED, GOAMD64 and so on
+			if setting.Value == "" || setting.Key == "DefaultGODEBUG" { // Unset, or a long list nobody tunes
+				continue
+			}
+			env["build:"+setting.Key] = setting.Value
+		}
+	}
+	return env
+}
@@ -0,0 +1,209 @@
+/*	A software renderer for machines without a GPU.
+	Transforms the cube built by buildCube for every live particle through the same frustum and rotation initScene sets up,
+	and rasterises it with a depth test and flat lighting into an in-memory framebuffer.
+	Lighting follows the fixed-function GL path: one directional light, the default material, and no GL_NORMALIZE,
+	so a face's diffuse term grows as the particle shrinks exactly as it does on the GPU.
+*/
+
+package main
+
+import (
+	gl "github.com/chsc/gogl/gl21"
+	"image"
+	"math"
+)
+
+const (
+	matAmbient   = 0.2 // GL's default material and light model colours
+	matDiffuse   = 0.8
+	modelAmbient = 0.2
+)
+
+type mat4 [16]float64 // A column-major 4x4 matrix, laid out as GL expects
+
+func identity() mat4 {
+	return mat4{0: 1, 5: 1, 10: 1, 15: 1}
+}
+
+func (a mat4) mul(b mat4) mat4 {
+	var m mat4
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += a[k*4+row] * b[col*4+k]
+			}
+			m[col*4+row] = sum
+		}
+	}
+	return m
+}
+
+func frustum(l, r, b, t, n, f float64) mat4 { // Equivalent of glFrustum
+	return mat4{
+		0: 2 * n / (r - l), 5: 2 * n / (t - b),
+		8: (r + l) / (r - l), 9: (t + b) / (t - b), 10: -(f + n) / (f - n), 11: -1,
+		14: -2 * f * n / (f - n),
+	}
+}
+
+func rotateX(deg float64) mat4 { // Equivalent of glRotate(deg, 1, 0, 0)
+	s, c := math.Sincos(deg * math.Pi / 180)
+	m := identity()
+	m[5], m[6] = c, s
+	m[9], m[10] = -s, c
+	return m
+}
+
+func projection() mat4 { // The projection matrix initScene builds
+	return frustum(-1, 1, -1, 1, ViewNear, ViewFar).mul(rotateX(ViewTilt))
+}
+
+func lightDirection() [3]float64 { // Unit vector towards the directional light set up in initScene
+	l := math.Sqrt(float64(lightPos[0]*lightPos[0] + lightPos[1]*lightPos[1] + lightPos[2]*lightPos[2]))
+	return [3]float64{float64(lightPos[0]) / l, float64(lightPos[1]) / l, float64(lightPos[2]) / l}
+}
+
+type screenVertex struct {
+	x, y, z float64 // Window coordinates, with z the depth in [0, 1]
+	clipped bool    // Whether the vertex lies on or behind the near plane
+}
+
+type softRenderer struct {
+	fb     *image.RGBA // The colour buffer
+	depth  []float32   // The depth buffer, one value per pixel
+	proj   mat4
+	clear  [4]uint8
+	light  [3]float64 // Unit vector towards the light
+	verts  [24]screenVertex
+	width  int
+	height int
+}
+
+func newSoftRenderer(width, height int) *softRenderer {
+	return &softRenderer{width: width, height: height}
+}
+
+func (s *softRenderer) Init() error {
+	s.fb = image.NewRGBA(image.Rect(0, 0, s.width, s.height))
+	s.depth = make([]float32, s.width*s.height)
+	s.proj = projection()
+	s.clear = [4]uint8{26, 26, 153, 255} // The clear colour from initScene
+	s.light = lightDirection()
+	return nil
+}
+
+func (s *softRenderer) Upload() {
+	buildCube()
+}
+
+func (s *softRenderer) Present() bool      { return true }
+func (s *softRenderer) Close()             {}
+func (s *softRenderer) Frame() *image.RGBA { return s.fb }
+
+func (s *softRenderer) clearBuffers() {
+	pix := s.fb.Pix
+	copy(pix, s.clear[:])
+	for n := 4; n < len(pix); n *= 2 { // Fill by doubling the already cleared prefix
+		copy(pix[n:], pix[:n])
+	}
+	for i := range s.depth {
+		s.depth[i] = 1
+	}
+}
+
+// shade returns the flat-lit colour of a face with the given normal on a cube scaled by scale.
+func (s *softRenderer) shade(n [3]gl.Float, scale float64) [4]uint8 {
+	dot := (float64(n[0])*s.light[0] + float64(n[1])*s.light[1] + float64(n[2])*s.light[2]) / scale
+	if dot < 0 || math.IsNaN(dot) {
+		dot = 0
+	}
+	var c [4]uint8
+	for i := 0; i < 3; i++ {
+		v := modelAmbient*matAmbient + float64(ambient[i])*matAmbient + float64(diffuse[i])*matDiffuse*dot
+		c[i] = uint8(math.Min(v, 1) * 255)
+	}
+	c[3] = 255
+	return c
+}
+
+func (s *softRenderer) DrawParticles() {
+	s.clearBuffers()
+	for i := minPt; i <= maxPt; i++ {
+		if Pts[i].is == false {
+			continue
+		}
+		s.drawCube(&Pts[i])
+	}
+}
+
+func (s *softRenderer) drawCube(pt *Pt) {
+	scale := pt.R * 2
+	m := &s.proj
+	for i := range Vertices {
+		p := &Vertices[i].pos
+		x := pt.X + float64(p[0])*scale // Same modelview as renderPts: translate, then scale
+		y := pt.Y + float64(p[1])*scale
+		z := -pt.Z + float64(p[2])*scale
+		cx := m[0]*x + m[4]*y + m[8]*z + m[12]
+		cy := m[1]*x + m[5]*y + m[9]*z + m[13]
+		cz := m[2]*x + m[6]*y + m[10]*z + m[14]
+		cw := m[3]*x + m[7]*y + m[11]*z + m[15]
+		v := &s.verts[i]
+		v.x = (cx/cw + 1) * float64(s.width) / 2
+		v.y = (1 - cy/cw) * float64(s.height) / 2 // Image rows run top to bottom
+		v.z = (cz/cw + 1) / 2
+		// Particles with zero radius are blown to infinity by the wind; GL quietly drops them and so do we
+		v.clipped = !(cw >= ViewNear) || math.IsInf(v.x+v.y, 0) || math.IsNaN(v.x+v.y)
+	}
+	for face := 0; face < 24; face += 4 {
+		col := s.shade(Vertices[face].normal, scale)
+		a, b, c, d := &s.verts[face], &s.verts[face+1], &s.verts[face+2], &s.verts[face+3]
+		s.drawTriangle(a, b, c, col)
+		s.drawTriangle(a, c, d, col)
+	}
+}
+
+func span(lo, hi float64, size int) (int, int) { // The pixel range covering [lo, hi], clamped to [0, size)
+	lo = math.Max(math.Floor(lo), 0)
+	hi = math.Min(math.Ceil(hi), float64(size-1))
+	if lo > hi {
+		return 0, -1
+	}
+	return int(lo), int(hi)
+}
+
+func edge(a, b *screenVertex, x, y float64) float64 {
+	return (b.x-a.x)*(y-a.y) - (b.y-a.y)*(x-a.x)
+}
+
+func (s *softRenderer) drawTriangle(a, b, c *screenVertex, col [4]uint8) {
+	if a.clipped || b.clipped || c.clipped { // Particles never reach the near plane, so dropping these costs nothing visible
+		return
+	}
+	area := edge(a, b, c.x, c.y)
+	if area == 0 {
+		return
+	}
+	minX, maxX := span(math.Min(a.x, math.Min(b.x, c.x)), math.Max(a.x, math.Max(b.x, c.x)), s.width)
+	minY, maxY := span(math.Min(a.y, math.Min(b.y, c.y)), math.Max(a.y, math.Max(b.y, c.y)), s.height)
+	for y := minY; y <= maxY; y++ {
+		py := float64(y) + 0.5
+		row := y * s.width
+		for x := minX; x <= maxX; x++ {
+			px := float64(x) + 0.5
+			w0 := edge(b, c, px, py) / area
+			w1 := edge(c, a, px, py) / area
+			w2 := edge(a, b, px, py) / area
+			if w0 < 0 || w1 < 0 || w2 < 0 { // Works for either winding, since dividing by area flips the signs
+				continue
+			}
+			z := float32(w0*a.z + w1*b.z + w2*c.z)
+			if z > s.depth[row+x] { // GL_LEQUAL
+				continue
+			}
+			s.depth[row+x] = z
+			copy(s.fb.Pix[y*s.fb.Stride+x*4:], col[:])
+		}
+	}
+}
@@ -0,0 +1,144 @@
+/*	Streams a JSON record for every frame to a Unix domain socket or pipe while the benchmark runs,
+	so Benchmarker.go can show live progress and notice a stuck implementation.
+	Records are handed to a writer goroutine through a buffered channel and dropped if it falls behind,
+	so a slow reader can never stall the animation.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const TelemetryEnv = "PARTICLEBENCH_TELEMETRY" // Benchmarker.go puts its socket's path here
+
+var telemetryPath = flag.String("telemetry", os.Getenv(TelemetryEnv), "Unix socket or named pipe to stream per-frame JSON records to; defaults to $"+TelemetryEnv)
+
+const (
+	phaseMove = iota
+	phaseWind
+	phaseSpawn
+	phaseCleanup
+	phaseCollide
+	numPhases
+)
+
+type FrameRecord struct {
+	Frame     uint64     `json:"frame"`      // Frames drawn so far, including those before measuring started
+	Time      float64    `json:"time"`       // Seconds of animation so far
+	FrameTime float64    `json:"frame_time"` // Seconds this frame took
+	Live      int        `json:"live"`       // Living particles
+	Phases    PhaseTimes `json:"phases"`     // Seconds spent in each part of the frame
+}
+
+type PhaseTimes struct {
+	Move    float64 `json:"move"`
+	Wind    float64 `json:"wind"`
+	Spawn   float64 `json:"spawn"`
+	Cleanup float64 `json:"cleanup"`
+	Collide float64 `json:"collide"`
+	Render  float64 `json:"render"` // Drawing and presenting, as recorded in gpuTimes
+}
+
+type telemetry struct {
+	out     io.WriteCloser
+	records chan FrameRecord
+	done    chan bool
+	frame   uint64
+	last    time.Time
+	phases  [numPhases]float64
+	dropped int
+}
+
+func newTelemetry(path string) (*telemetry, error) {
+	var out io.WriteCloser
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		out, err = net.Dial("unix", path)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		out, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644) // Blocks until a pipe has a reader
+		if err != nil {
+			return nil, err
+		}
+	}
+	t := &telemetry{out: out, records: make(chan FrameRecord, 1024), done: make(chan bool)}
+	go t.write()
+	return t, nil
+}
+
+func (t *telemetry) write() {
+	w := bufio.NewWriter(t.out)
+	enc := json.NewEncoder(w)
+	for rec := range t.records {
+		if err := enc.Encode(rec); err != nil {
+			fmt.Println("Telemetry stream failed with error", err)
+			break
+		}
+		if len(t.records) == 0 { // Flush whenever we've caught up, so the reader sees frames as they happen
+			w.Flush()
+		}
+	}
+	for range t.records { // Drain, so senders never block after a failure
+	}
+	w.Flush()
+	t.out.Close()
+	t.done <- true
+}
+
+// begin starts timing a frame's phases; it and the other methods do nothing on a nil *telemetry.
+func (t *telemetry) begin(frameStart time.Time) {
+	if t == nil {
+		return
+	}
+	t.last = frameStart
+}
+
+func (t *telemetry) mark(phase int) { // Records the time since the last mark as spent in phase
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.phases[phase] = now.Sub(t.last).Seconds()
+	t.last = now
+}
+
+func (t *telemetry) send(frameDur, renderDur float64) {
+	if t == nil {
+		return
+	}
+	live := 0
+	for i := minPt; i <= maxPt; i++ {
+		if Pts[i].is {
+			live++
+		}
+	}
+	t.frame++
+	rec := FrameRecord{Frame: t.frame, Time: runTmr, FrameTime: frameDur, Live: live,
+		Phases: PhaseTimes{Move: t.phases[phaseMove], Wind: t.phases[phaseWind], Spawn: t.phases[phaseSpawn],
+			Cleanup: t.phases[phaseCleanup], Collide: t.phases[phaseCollide], Render: renderDur}}
+	select {
+	case t.records <- rec:
+	default:
+		t.dropped++
+	}
+}
+
+func (t *telemetry) close() {
+	if t == nil {
+		return
+	}
+	close(t.records)
+	<-t.done
+	if t.dropped > 0 {
+		fmt.Printf("Dropped %v telemetry records because the reader fell behind.\n", t.dropped)
+	}
+}